@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gookit/slog"
+	"github.com/yadq/moko/mock"
+	"gopkg.in/yaml.v3"
+)
+
+// loadCheckConfig parses flags of check subcommand, and loads servers to check
+func loadCheckConfig(name string, args []string) (*mock.ServersConfig, error) {
+	var cfgFile, protocol string
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.StringVar(&protocol, "protocol", "http", "mock server protocol, ignored if cfg lists servers")
+	fs.StringVar(&cfgFile, "cfg", "", "mock configuration yaml")
+	fs.Parse(args)
+	if cfgFile == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// only errors are reported by subcommands
+	slog.SetLogLevel(slog.ErrorLevel)
+
+	return mock.LoadServersConfig(cfgFile, protocol)
+}
+
+// validate checks config of all servers without binding ports, and returns
+// exit code
+func validate(args []string) int {
+	c, err := loadCheckConfig("validate", args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	code := 0
+	for _, cfg := range c.Servers {
+		if _, err := mock.CheckConfig(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintf(os.Stderr, "%s server %s: invalid config %s\n", cfg.Protocol, cfg.Name, cfg.CfgFile)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s server %s: ok\n", cfg.Protocol, cfg.Name)
+	}
+
+	return code
+}
+
+// routes prints effective normalized routes of all servers, and returns exit
+// code
+func routes(args []string) int {
+	c, err := loadCheckConfig("routes", args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	code := 0
+	for idx, cfg := range c.Servers {
+		server, err := mock.CheckConfig(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			fmt.Fprintf(os.Stderr, "%s server %s: invalid config %s\n", cfg.Protocol, cfg.Name, cfg.CfgFile)
+			code = 1
+			continue
+		}
+		if idx > 0 {
+			fmt.Println("---")
+		}
+		fmt.Printf("# %s server %s: %s\n", cfg.Protocol, cfg.Name, cfg.CfgFile)
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		out := map[string]interface{}{"routes": server.ListRoutes()}
+		if h, ok := server.(interface{ ListHosts() []*mock.HttpHost }); ok && len(h.ListHosts()) > 0 {
+			out["hosts"] = h.ListHosts()
+		}
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	return code
+}
@@ -1,10 +1,11 @@
-module moko
+module github.com/yadq/moko
 
 go 1.18
 
 require (
 	github.com/fsnotify/fsnotify v1.7.0
 	github.com/gookit/slog v0.5.4
+	github.com/gorilla/websocket v1.5.3
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/miekg/dns v1.1.57
 	github.com/smartystreets/goconvey v1.6.4
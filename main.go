@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -10,10 +12,13 @@ import (
 	"syscall"
 
 	"github.com/gookit/slog"
+	"github.com/yadq/moko/mock"
 )
 
 func main() {
-	var cfgFile, protocol string
+	var cfgFile, protocol, adminAddr string
+	var journalSize int
+	var seed int64
 
 	slog.Configure(func(logger *slog.SugaredLogger) {
 		f := logger.Formatter.(*slog.TextFormatter)
@@ -21,35 +26,82 @@ func main() {
 		f.SetTemplate("[{{datetime}}] [{{level}}] {{message}}\n")
 	})
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(validate(os.Args[2:]))
+		case "routes":
+			os.Exit(routes(os.Args[2:]))
+		}
+	}
+
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: moko -protocol <%v> -cfg <cfg yaml file>\n", strings.Join(ServerMap.List(), ", "))
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: moko -protocol <%v> -cfg <cfg yaml file>\n", strings.Join(mock.ServerMap.List(), ", "))
+		fmt.Fprintf(flag.CommandLine.Output(), "       moko -cfg <servers yaml file>\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "       moko validate [-protocol <protocol>] -cfg <cfg yaml file>\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "       moko routes [-protocol <protocol>] -cfg <cfg yaml file>\n")
 		flag.PrintDefaults()
 	}
-	flag.StringVar(&protocol, "protocol", "http", "mock server protocol")
+	flag.StringVar(&protocol, "protocol", "http", "mock server protocol, ignored if cfg lists servers")
 	flag.StringVar(&cfgFile, "cfg", "", "mock configuration yaml")
+	flag.StringVar(&adminAddr, "admin", "", "admin API listen address, eg. 127.0.0.1:9090, overrides admin in cfg")
+	flag.IntVar(&journalSize, "journal", mock.DefaultJournalSize, "max number of received requests kept in journal")
+	flag.Int64Var(&seed, "seed", 0, "seed of random responses for reproducible runs, random if 0")
 	flag.Parse()
 
 	if _, err := os.Stat(cfgFile); os.IsNotExist(err) {
 		slog.Fatalf("cfg file %v does not exist", cfgFile)
 	}
 
-	server, err := ServerMap.Get(protocol)
+	c, err := mock.LoadServersConfig(cfgFile, protocol)
 	if err != nil {
-		slog.Fatal(err.Error())
+		slog.Fatal(err)
+	}
+	if adminAddr == "" {
+		adminAddr = c.Admin
 	}
 
-	if err = server.Init(cfgFile); err != nil {
-		slog.Fatal(err)
+	mock.RequestJournal = mock.NewJournal(journalSize)
+	if seed != 0 {
+		mock.SetSeed(seed)
+	}
+	group := mock.NewServerGroup()
+	for _, cfg := range c.Servers {
+		if err := group.Start(cfg); err != nil {
+			slog.Errorf("start %s server %s error: %v", cfg.Protocol, cfg.Name, err)
+		}
+	}
+	if group.Len() == 0 {
+		slog.Fatal("no server started")
+	}
+
+	var admin *mock.AdminServer
+	var adminWg sync.WaitGroup
+	if adminAddr != "" {
+		admin = mock.NewAdminServer(adminAddr, group)
+		adminWg.Add(1)
+		go func() {
+			if err := admin.Serve(&adminWg); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Errorf("admin server stopped: %v", err)
+			}
+		}()
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go server.Serve(&wg)
+	exitCode := 0
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	s := <-sig
-	slog.Infof("signal (%s) received, stopping...", s)
-	server.Shutdown()
-	wg.Wait()
+	select {
+	case s := <-sig:
+		slog.Infof("signal (%s) received, stopping...", s)
+	case <-group.Done():
+		slog.Error("all servers stopped, exiting...")
+		exitCode = 1
+	}
+	if admin != nil {
+		admin.Shutdown()
+		adminWg.Wait()
+	}
+	group.Shutdown()
 	slog.Info("server shutdown")
+	os.Exit(exitCode)
 }
@@ -0,0 +1,393 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gookit/slog"
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/yaml.v3"
+)
+
+// admin API, request body is a route (or list of routes for PUT all) in JSON or YAML
+//
+// GET    /servers                   list servers
+// GET    /servers/:name/routes      list routes
+// POST   /servers/:name/routes      add a route
+// PUT    /servers/:name/routes      replace all routes
+// PUT    /servers/:name/routes/:idx replace the route at index idx
+// DELETE /servers/:name/routes/:idx delete the route at index idx
+// POST   /servers/:name/reset       reset routes to cfg file
+// POST   /servers/:name/sequences/reset reset sequence counters, of client ?key= only if set
+// GET    /servers/:name/scenarios   list current states of scenarios
+// PUT    /servers/:name/scenarios/:scenario move scenario to state of body {"state": "..."}
+// POST   /servers/:name/scenarios/reset reset scenarios to initial states, of ?scenario= only if set
+// POST   /reset                     reset routes of all servers to cfg files, none if any cfg is invalid
+//
+// Journal API, requests are filtered by query protocol, method, path, route, fqdn and qtype
+//
+// GET    /journal                   list recorded requests
+// GET    /journal/count             count recorded requests
+// GET    /journal/verify?times=N    verify requests are recorded N times, return 417 if not
+// DELETE /journal                   clear recorded requests
+
+// routeStore is implemented by servers whose routes can be changed at runtime
+type routeStore interface {
+	ListRoutes() interface{}
+	AddRoute(data []byte) error
+	UpdateRoute(idx int, data []byte) error
+	DeleteRoute(idx int) error
+	SetRoutes(data []byte) error
+	ResetRoutes() error
+}
+
+// resetPreparer is implemented by servers whose config can be checked before
+// reset, so that all servers are checked before any of them is reset
+type resetPreparer interface {
+	prepareReset() (func() error, error)
+}
+
+// sequenceStore is implemented by servers with sequenced responses
+type sequenceStore interface {
+	ResetSequences(key string)
+}
+
+// scenarioStore is implemented by servers with stateful scenarios
+type scenarioStore interface {
+	ListScenarios() map[string]string
+	SetScenario(name string, state string) error
+	ResetScenarios(name string) error
+}
+
+type AdminServer struct {
+	group   *ServerGroup
+	journal *Journal
+	router  *httprouter.Router
+	server  *http.Server
+}
+
+func NewAdminServer(addr string, group *ServerGroup) *AdminServer {
+	a := &AdminServer{group: group, journal: RequestJournal, router: httprouter.New()}
+	a.router.GET("/servers", a.listServers)
+	a.router.GET("/servers/:name/routes", a.listRoutes)
+	a.router.POST("/servers/:name/routes", a.addRoute)
+	a.router.PUT("/servers/:name/routes", a.setRoutes)
+	a.router.PUT("/servers/:name/routes/:idx", a.updateRoute)
+	a.router.DELETE("/servers/:name/routes/:idx", a.deleteRoute)
+	a.router.POST("/servers/:name/reset", a.resetRoutes)
+	a.router.POST("/servers/:name/sequences/reset", a.resetSequences)
+	a.router.GET("/servers/:name/scenarios", a.listScenarios)
+	a.router.PUT("/servers/:name/scenarios/:scenario", a.setScenario)
+	a.router.POST("/servers/:name/scenarios/reset", a.resetScenarios)
+	a.router.POST("/reset", a.resetAll)
+	a.router.GET("/journal", a.listJournal)
+	a.router.GET("/journal/count", a.countJournal)
+	a.router.GET("/journal/verify", a.verifyJournal)
+	a.router.DELETE("/journal", a.clearJournal)
+	a.server = &http.Server{Addr: addr, Handler: a.router}
+
+	return a
+}
+
+func (a *AdminServer) Serve(wg *sync.WaitGroup) error {
+	defer wg.Done()
+
+	slog.Infof("start admin server on %s", a.server.Addr)
+	return a.server.ListenAndServe()
+}
+
+func (a *AdminServer) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return a.server.Shutdown(ctx)
+}
+
+// writeJSON writes v as JSON, keys are the same as in YAML cfg
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	var d interface{}
+	data, err := yaml.Marshal(v)
+	if err == nil {
+		err = yaml.Unmarshal(data, &d)
+	}
+	if err == nil {
+		data, err = MarshalJSON(d)
+	}
+	if err != nil {
+		slog.Errorf("marshal admin response error: %v", err)
+		code = http.StatusInternalServerError
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// lookupServer returns the named server, error is written if it does not exist
+func (a *AdminServer) lookupServer(w http.ResponseWriter, name string) (Server, bool) {
+	server, exists := a.group.servers[name]
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Errorf("server %s does not exist", name))
+	}
+
+	return server, exists
+}
+
+func (a *AdminServer) routeStore(w http.ResponseWriter, name string) (routeStore, bool) {
+	server, exists := a.lookupServer(w, name)
+	if !exists {
+		return nil, false
+	}
+	store, ok := server.(routeStore)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("server %s does not support route update", name))
+		return nil, false
+	}
+
+	return store, true
+}
+
+// update runs fn with the named route store and request body
+func (a *AdminServer) update(w http.ResponseWriter, r *http.Request, ps httprouter.Params, fn func(routeStore, []byte) error) {
+	store, ok := a.routeStore(w, ps.ByName("name"))
+	if !ok {
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := fn(store, data); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, store.ListRoutes())
+}
+
+func routeIndex(ps httprouter.Params) (int, error) {
+	idx, err := strconv.Atoi(ps.ByName("idx"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid route index %s", ps.ByName("idx"))
+	}
+
+	return idx, nil
+}
+
+func (a *AdminServer) listServers(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	servers := make([]*ServerConfig, len(a.group.names))
+	for idx, name := range a.group.names {
+		servers[idx] = a.group.cfgs[name]
+	}
+	writeJSON(w, http.StatusOK, servers)
+}
+
+func (a *AdminServer) listRoutes(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	store, ok := a.routeStore(w, ps.ByName("name"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, store.ListRoutes())
+}
+
+func (a *AdminServer) addRoute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	a.update(w, r, ps, func(store routeStore, data []byte) error {
+		return store.AddRoute(data)
+	})
+}
+
+func (a *AdminServer) setRoutes(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	a.update(w, r, ps, func(store routeStore, data []byte) error {
+		return store.SetRoutes(data)
+	})
+}
+
+func (a *AdminServer) updateRoute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	a.update(w, r, ps, func(store routeStore, data []byte) error {
+		idx, err := routeIndex(ps)
+		if err != nil {
+			return err
+		}
+		return store.UpdateRoute(idx, data)
+	})
+}
+
+func (a *AdminServer) deleteRoute(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	a.update(w, r, ps, func(store routeStore, data []byte) error {
+		idx, err := routeIndex(ps)
+		if err != nil {
+			return err
+		}
+		return store.DeleteRoute(idx)
+	})
+}
+
+func (a *AdminServer) resetRoutes(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	a.update(w, r, ps, func(store routeStore, data []byte) error {
+		return store.ResetRoutes()
+	})
+}
+
+func (a *AdminServer) resetSequences(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	name := ps.ByName("name")
+	server, exists := a.lookupServer(w, name)
+	if !exists {
+		return
+	}
+	store, ok := server.(sequenceStore)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("server %s does not support sequences", name))
+		return
+	}
+	store.ResetSequences(r.URL.Query().Get("key"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *AdminServer) scenarioStore(w http.ResponseWriter, name string) (scenarioStore, bool) {
+	server, exists := a.lookupServer(w, name)
+	if !exists {
+		return nil, false
+	}
+	store, ok := server.(scenarioStore)
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("server %s does not support scenarios", name))
+		return nil, false
+	}
+
+	return store, true
+}
+
+func (a *AdminServer) listScenarios(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	store, ok := a.scenarioStore(w, ps.ByName("name"))
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, store.ListScenarios())
+}
+
+func (a *AdminServer) setScenario(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	store, ok := a.scenarioStore(w, ps.ByName("name"))
+	if !ok {
+		return
+	}
+	var body struct {
+		State string `yaml:"state"`
+	}
+	data, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = yaml.Unmarshal(data, &body)
+	}
+	if err == nil && body.State == "" {
+		err = fmt.Errorf("state is not set")
+	}
+	if err == nil {
+		err = store.SetScenario(ps.ByName("scenario"), body.State)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, store.ListScenarios())
+}
+
+func (a *AdminServer) resetScenarios(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	store, ok := a.scenarioStore(w, ps.ByName("name"))
+	if !ok {
+		return
+	}
+	if err := store.ResetScenarios(r.URL.Query().Get("scenario")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, store.ListScenarios())
+}
+
+// resetAll reloads configs of all servers before resetting any of them, no
+// server is reset if any config is invalid. If a server still fails to reset
+// (eg. its new port is in use), servers already reset are reported.
+func (a *AdminServer) resetAll(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var names []string
+	var resets []func() error
+	var errs configErrors
+	for _, name := range a.group.names {
+		server := a.group.servers[name]
+		store, ok := server.(routeStore)
+		if !ok {
+			continue
+		}
+		reset := store.ResetRoutes
+		if p, ok := server.(resetPreparer); ok {
+			var err error
+			if reset, err = p.prepareReset(); err != nil {
+				errs = append(errs, fmt.Errorf("reset server %s error: %v", name, err))
+				continue
+			}
+		}
+		names, resets = append(names, name), append(resets, reset)
+	}
+	if len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, errs)
+		return
+	}
+
+	for idx, reset := range resets {
+		if err := reset(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error": fmt.Sprintf("reset server %s error: %v", names[idx], err),
+				"reset": names[:idx],
+			})
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newJournalFilter(r *http.Request) *JournalFilter {
+	q := r.URL.Query()
+	return &JournalFilter{
+		Protocol: q.Get("protocol"),
+		Method:   q.Get("method"),
+		Host:     q.Get("host"),
+		Path:     q.Get("path"),
+		Route:    q.Get("route"),
+		Fqdn:     q.Get("fqdn"),
+		Qtype:    q.Get("qtype"),
+	}
+}
+
+func (a *AdminServer) listJournal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	writeJSON(w, http.StatusOK, a.journal.Find(newJournalFilter(r)))
+}
+
+func (a *AdminServer) countJournal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	writeJSON(w, http.StatusOK, map[string]int{"count": len(a.journal.Find(newJournalFilter(r)))})
+}
+
+func (a *AdminServer) verifyJournal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	times, err := strconv.Atoi(r.URL.Query().Get("times"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid times %s", r.URL.Query().Get("times")))
+		return
+	}
+	count := len(a.journal.Find(newJournalFilter(r)))
+	code := http.StatusOK
+	if count != times {
+		code = http.StatusExpectationFailed
+	}
+	writeJSON(w, code, map[string]int{"expected": times, "count": count})
+}
+
+func (a *AdminServer) clearJournal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	a.journal.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,245 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAdminServer(t *testing.T) {
+	hs := NewHttpServer()
+	hs.Init("../examples/http-mock.yml")
+	ds := NewDNSServer()
+	ds.Init("../examples/dns-mock.yml")
+	g := NewServerGroup()
+	g.add(&ServerConfig{Name: "api", Protocol: "http", CfgFile: "../examples/http-mock.yml"}, hs)
+	g.add(&ServerConfig{Name: "resolver", Protocol: "dns", CfgFile: "../examples/dns-mock.yml"}, ds)
+	a := NewAdminServer(":0", g)
+	a.journal = NewJournal(10)
+	hs.server.Handler = journalHandler(a.journal, hs)
+
+	doAdminRequest := func(method string, uri string, data string) (*http.Response, []interface{}) {
+		req, _ := http.NewRequest(method, uri, strings.NewReader(data))
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, req)
+		resp := w.Result()
+		var items []interface{}
+		body, _ := io.ReadAll(resp.Body)
+		json.Unmarshal(body, &items)
+
+		return resp, items
+	}
+
+	doHTTPRequest := func(method string, uri string) *http.Response {
+		req, _ := http.NewRequest(method, uri, nil)
+		w := httptest.NewRecorder()
+		hs.server.Handler.ServeHTTP(w, req)
+
+		return w.Result()
+	}
+
+	Convey("list servers", t, func() {
+		resp, items := doAdminRequest("GET", "/servers", "")
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(len(items), ShouldEqual, 2)
+		So(items[0].(map[string]interface{})["name"], ShouldEqual, "api")
+	})
+
+	Convey("list routes", t, func() {
+		resp, items := doAdminRequest("GET", "/servers/api/routes", "")
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(len(items), ShouldEqual, len(hs.Routes))
+		So(items[0].(map[string]interface{})["uri"], ShouldEqual, "/hello")
+		resp, _ = doAdminRequest("GET", "/servers/does-not-exist/routes", "")
+		So(resp.StatusCode, ShouldEqual, 404)
+	})
+
+	Convey("add, update and delete HTTP route", t, func() {
+		n := len(hs.Routes)
+		resp, items := doAdminRequest("POST", "/servers/api/routes", `{"uri": "/admin/new", "response": {"code": 202, "body": "new"}}`)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(len(items), ShouldEqual, n+1)
+		So(doHTTPRequest("GET", "/admin/new").StatusCode, ShouldEqual, 202)
+
+		resp, _ = doAdminRequest("PUT", "/servers/api/routes/"+strconv.Itoa(n), "uri: /admin/new\nresponse:\n  code: 203\n")
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(doHTTPRequest("GET", "/admin/new").StatusCode, ShouldEqual, 203)
+
+		resp, items = doAdminRequest("DELETE", "/servers/api/routes/"+strconv.Itoa(n), "")
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(len(items), ShouldEqual, n)
+		So(doHTTPRequest("GET", "/admin/new").StatusCode, ShouldEqual, 404)
+
+		resp, _ = doAdminRequest("DELETE", "/servers/api/routes/100", "")
+		So(resp.StatusCode, ShouldEqual, 400)
+	})
+
+	Convey("keep routes on conflicted route", t, func() {
+		n := len(hs.Routes)
+		resp, _ := doAdminRequest("POST", "/servers/api/routes", `{"uri": "/hello/:id"}`)
+		So(resp.StatusCode, ShouldEqual, 400)
+		So(len(hs.Routes), ShouldEqual, n)
+		So(doHTTPRequest("GET", "/hello").StatusCode, ShouldEqual, 201)
+	})
+
+	Convey("replace all routes and reset", t, func() {
+		n := len(hs.Routes)
+		resp, items := doAdminRequest("PUT", "/servers/api/routes", `[{"uri": "/only"}]`)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(len(items), ShouldEqual, 1)
+		So(doHTTPRequest("GET", "/only").StatusCode, ShouldEqual, 200)
+		So(doHTTPRequest("GET", "/hello").StatusCode, ShouldEqual, 404)
+
+		resp, items = doAdminRequest("POST", "/servers/api/reset", "")
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(len(items), ShouldEqual, n)
+		So(doHTTPRequest("GET", "/hello").StatusCode, ShouldEqual, 201)
+	})
+
+	Convey("add and reset DNS records", t, func() {
+		resp, items := doAdminRequest("POST", "/servers/resolver/routes", `{"rrtype": "A", "fqdn": "new.my.internal", "ip": "127.0.0.3"}`)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(len(items), ShouldEqual, 3)
+		So(items[2].(map[string]interface{})["fqdn"], ShouldEqual, "new.my.internal.")
+
+		resp, _ = doAdminRequest("POST", "/servers/resolver/routes", `{"rrtype": "A", "fqdn": "bad.my.internal", "ip": "not-an-ip"}`)
+		So(resp.StatusCode, ShouldEqual, 400)
+
+		resp, _ = doAdminRequest("POST", "/reset", "")
+		So(resp.StatusCode, ShouldEqual, 204)
+		So(len(ds.Routes), ShouldEqual, 2)
+	})
+
+	Convey("reset sequences", t, func() {
+		resp, _ := doAdminRequest("POST", "/servers/api/routes", "uri: /admin/job\nsequence:\n  responses: [{code: 202}, {code: 200}]\n")
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(doHTTPRequest("GET", "/admin/job").StatusCode, ShouldEqual, 202)
+		So(doHTTPRequest("GET", "/admin/job").StatusCode, ShouldEqual, 200)
+
+		resp, _ = doAdminRequest("POST", "/servers/api/sequences/reset", "")
+		So(resp.StatusCode, ShouldEqual, 204)
+		So(doHTTPRequest("GET", "/admin/job").StatusCode, ShouldEqual, 202)
+
+		resp, _ = doAdminRequest("POST", "/servers/resolver/sequences/reset", "")
+		So(resp.StatusCode, ShouldEqual, 400)
+		resp, _ = doAdminRequest("POST", "/servers/api/reset", "")
+		So(resp.StatusCode, ShouldEqual, 200)
+	})
+
+	Convey("list, set and reset scenarios", t, func() {
+		resp, _ := doAdminRequest("POST", "/servers/api/routes", "uri: /admin/state\nscenario:\n  name: admin\n  state: on\n")
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(doHTTPRequest("GET", "/admin/state").StatusCode, ShouldEqual, 404)
+
+		resp, _ = doAdminRequest("PUT", "/servers/api/scenarios/admin", `{"state": "on"}`)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(doHTTPRequest("GET", "/admin/state").StatusCode, ShouldEqual, 200)
+		resp, _ = doAdminRequest("PUT", "/servers/api/scenarios/unknown", `{"state": "on"}`)
+		So(resp.StatusCode, ShouldEqual, 400)
+
+		req, _ := http.NewRequest("GET", "/servers/api/scenarios", nil)
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, req)
+		So(w.Body.String(), ShouldEqual, `{"admin":"on"}`)
+
+		resp, _ = doAdminRequest("POST", "/servers/api/scenarios/reset?scenario=admin", "")
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(doHTTPRequest("GET", "/admin/state").StatusCode, ShouldEqual, 404)
+		resp, _ = doAdminRequest("POST", "/servers/api/reset", "")
+		So(resp.StatusCode, ShouldEqual, 200)
+	})
+
+	Convey("query, verify and clear journal", t, func() {
+		a.journal.Clear()
+		doHTTPRequest("GET", "/hello")
+		doHTTPRequest("GET", "/hello")
+		doHTTPRequest("GET", "/hello/world")
+
+		resp, items := doAdminRequest("GET", "/journal?method=GET&path=/hello", "")
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(len(items), ShouldEqual, 2)
+		So(items[0].(map[string]interface{})["route"], ShouldEqual, "GET /hello")
+
+		resp, _ = doAdminRequest("GET", "/journal/verify?route=/hello/:name&times=1", "")
+		So(resp.StatusCode, ShouldEqual, 200)
+		resp, _ = doAdminRequest("GET", "/journal/verify?path=/hello&times=1", "")
+		So(resp.StatusCode, ShouldEqual, 417)
+
+		resp, _ = doAdminRequest("DELETE", "/journal", "")
+		So(resp.StatusCode, ShouldEqual, 204)
+		req, _ := http.NewRequest("GET", "/journal/count", nil)
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, req)
+		So(w.Body.String(), ShouldEqual, `{"count":0}`)
+	})
+}
+
+func TestAdminResetAll(t *testing.T) {
+	dir := t.TempDir()
+	httpFile := filepath.Join(dir, "http-mock.yml")
+	dnsFile := filepath.Join(dir, "dns-mock.yml")
+	port := freePort(t)
+	os.WriteFile(httpFile, []byte(fmt.Sprintf("port: %d\nroutes:\n  - uri: /hello\n", port)), 0644)
+	os.WriteFile(dnsFile, []byte("routes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.1\n"), 0644)
+	ds := NewDNSServer()
+	if err := ds.loadConfig(dnsFile); err != nil {
+		t.Fatal(err)
+	}
+	hs := NewHttpServer()
+	if err := hs.loadConfig(httpFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hs.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer hs.Shutdown()
+	g := NewServerGroup()
+	g.add(&ServerConfig{Name: "resolver", Protocol: "dns", CfgFile: dnsFile}, ds)
+	g.add(&ServerConfig{Name: "api", Protocol: "http", CfgFile: httpFile}, hs)
+	a := NewAdminServer(":0", g)
+
+	resetAll := func() (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		a.router.ServeHTTP(w, httptest.NewRequest("POST", "/reset", nil))
+		var body map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	Convey("reset no server if any config is invalid", t, func() {
+		os.WriteFile(dnsFile, []byte("routes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.2\n"), 0644)
+		os.WriteFile(httpFile, []byte(fmt.Sprintf("port: %d\nroutes:\n  - uri: /hello\n    request:\n      query:\n        id: {regex: \"(\"}\n", port)), 0644)
+		code, body := resetAll()
+		So(code, ShouldEqual, 400)
+		So(body["error"], ShouldStartWith, "reset server api error: ")
+		So(ds.Routes[0].Ip, ShouldEqual, "127.0.0.1")
+	})
+
+	Convey("report servers reset before a failed one", t, func() {
+		l, err := net.Listen("tcp", ":0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+		os.WriteFile(httpFile, []byte(fmt.Sprintf("port: %d\nroutes:\n  - uri: /busy\n", l.Addr().(*net.TCPAddr).Port)), 0644)
+		code, body := resetAll()
+		So(code, ShouldEqual, 400)
+		So(body["error"], ShouldStartWith, "reset server api error: ")
+		So(body["reset"], ShouldResemble, []interface{}{"resolver"})
+		So(ds.Routes[0].Ip, ShouldEqual, "127.0.0.2")
+		So(getUris(hs.Routes), ShouldResemble, []string{"GET /hello"})
+
+		os.WriteFile(httpFile, []byte(fmt.Sprintf("port: %d\nroutes:\n  - uri: /hello\n  - uri: /world\n", port)), 0644)
+		code, _ = resetAll()
+		So(code, ShouldEqual, 204)
+		So(getUris(hs.Routes), ShouldResemble, []string{"GET /hello", "GET /world"})
+	})
+}
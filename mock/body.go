@@ -0,0 +1,261 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// file, binary and static responses example
+//
+// routes:
+//   - uri: /report
+//     response:
+//       bodyFile: fixtures/report.pdf # relative to config file, reloaded on change
+//   - uri: /users/:id
+//     response:
+//       bodyFile: fixtures/user-${id}.json # path rendered as template
+//       template: true # render file content as template
+//   - uri: /pixel.gif
+//     response:
+//       headers:
+//         Content-Type: image/gif # detected from file extension or content if not set
+//       bodyBase64: R0lGODlhAQABAAAAACw=
+//   - uri: /assets/*filepath
+//     static: public # serve directory, with Range and Last-Modified handling
+
+var errPathOutside = errors.New("path is outside of body file dir")
+
+// hasRawBody reports whether body is written as is, from file or base64
+func (r *HttpResponse) hasRawBody() bool {
+	return r.BodyFile != "" || r.BodyBase64 != ""
+}
+
+// templatedFile reports whether body file path is rendered per request
+func (r *HttpResponse) templatedFile() bool {
+	return strings.Contains(r.BodyFile, "${") || strings.Contains(r.BodyFile, "{{")
+}
+
+// compileBody checks body sources, and loads body of base64 or untemplated file
+// into c
+func (r *HttpResponse) compileBody(c *compiledResponse) error {
+	sources := 0
+	for _, set := range []bool{r.Body != nil, r.BodyFile != "", r.BodyBase64 != "", r.Stream != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return errors.New("only one of body, bodyFile, bodyBase64 and stream can be used")
+	}
+
+	switch {
+	case r.BodyBase64 != "":
+		data, err := base64.StdEncoding.DecodeString(r.BodyBase64)
+		if err != nil {
+			return fmt.Errorf("invalid bodyBase64: %v", err)
+		}
+		c.data = data
+	case r.BodyFile != "" && !r.templatedFile():
+		data, err := os.ReadFile(r.BodyFile)
+		if err != nil {
+			return err
+		}
+		c.data = data
+	}
+
+	return nil
+}
+
+// compileTemplates parses templates of headers, body and untemplated body
+// file into c
+func (r *HttpResponse) compileTemplates(c *compiledResponse) error {
+	keys := make([]string, 0, len(r.Headers))
+	for k := range r.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	c.headers = make([]*headerTemplate, 0, len(keys))
+	for _, k := range keys {
+		key, err := newTextTemplate(k)
+		if err != nil {
+			return fmt.Errorf("header %s: %v", k, err)
+		}
+		value, err := newTextTemplate(r.Headers[k])
+		if err != nil {
+			return fmt.Errorf("header %s: %v", k, err)
+		}
+		c.headers = append(c.headers, &headerTemplate{key: key, value: value})
+	}
+
+	switch r.Body.(type) {
+	case nil, string:
+		if r.Indent != 0 {
+			return errors.New("indent can only be used with structured body")
+		}
+	}
+	if r.Indent < 0 {
+		return errors.New("indent can not be negative")
+	}
+	switch body := r.Body.(type) {
+	case nil: // empty
+	case string: // text
+		t, err := newTextTemplate(body)
+		if err != nil {
+			return fmt.Errorf("body: %v", err)
+		}
+		c.body = t
+	default: // json, static body is marshaled once
+		data, err := MarshalJSON(body)
+		if err != nil {
+			return fmt.Errorf("marshal body: %v", err)
+		}
+		t, err := newJSONTemplate(body)
+		if err != nil {
+			return fmt.Errorf("body: %v", err)
+		}
+		if t.kind != jsonStatic {
+			c.object = t
+		}
+		c.body, c.json = &textTemplate{text: r.indentJSON(string(data))}, true
+	}
+
+	if r.templatedFile() {
+		path, err := newTextTemplate(r.BodyFile)
+		if err != nil {
+			return fmt.Errorf("bodyFile: %v", err)
+		}
+		c.path, c.root = path, fileRoot(r.BodyFile)
+	}
+	if r.Template && c.data != nil && !r.templatedFile() {
+		file, err := newTextTemplate(string(c.data))
+		if err != nil {
+			return fmt.Errorf("bodyFile: %v", err)
+		}
+		c.file = file
+	}
+
+	return nil
+}
+
+// indentJSON indents JSON body by Indent spaces
+func (r *HttpResponse) indentJSON(data string) string {
+	if r.Indent <= 0 {
+		return data
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(data), "", strings.Repeat(" ", r.Indent)); err != nil {
+		return data
+	}
+
+	return buf.String()
+}
+
+// rawBody returns body from file or base64, nil if not set
+func (r *HttpResponse) rawBody(params map[string]interface{}) ([]byte, error) {
+	c := r.compiled
+	if c.file != nil {
+		rendered, err := c.file.render(params)
+		return []byte(rendered), err
+	}
+	data := c.data
+	if c.path != nil {
+		file, err := c.path.render(params)
+		if err != nil {
+			return nil, err
+		}
+		file = filepath.Clean(file)
+		if rel, err := filepath.Rel(c.root, file); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s: %w", file, errPathOutside)
+		}
+		if data, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if !r.Template || data == nil {
+		return data, nil
+	}
+	rendered, err := renderString(string(data), params)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(rendered), nil
+}
+
+// contentType returns content type by extension of body file, or detected
+// from data
+func (r *HttpResponse) contentType(data []byte) string {
+	if r.BodyFile != "" {
+		if t := mime.TypeByExtension(filepath.Ext(r.BodyFile)); t != "" {
+			return t
+		}
+	}
+
+	return http.DetectContentType(data)
+}
+
+// resolveBodyFile resolves body file path against config file dir, templated
+// paths are not checked for existence
+func resolveBodyFile(dir string, file string) string {
+	r := &HttpResponse{BodyFile: file}
+	if dir == "" || filepath.IsAbs(file) || !r.templatedFile() {
+		return resolvePath(dir, file)
+	}
+
+	return filepath.Join(dir, file)
+}
+
+// fileRoot returns dir of the static prefix of templated path, eg.
+// "fixtures" of "fixtures/user-${id}.json"
+func fileRoot(file string) string {
+	end := len(file)
+	for _, delim := range []string{"${", "{{"} {
+		if idx := strings.Index(file, delim); idx >= 0 && idx < end {
+			end = idx
+		}
+	}
+
+	return filepath.Dir(file[:end])
+}
+
+// compileStatic checks static dir and uri of route
+func (r *HttpRoute) compileStatic() error {
+	if !strings.Contains(r.Uri, "/*") {
+		return fmt.Errorf("uri of static route must end with catch-all parameter, eg. %s/*filepath", strings.TrimSuffix(r.Uri, "/"))
+	}
+	if r.Method != http.MethodGet {
+		return errors.New("method of static route must be GET")
+	}
+	info, err := os.Stat(r.Static)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("static %s is not a directory", r.Static)
+	}
+	r.static = http.FileServer(http.Dir(r.Static))
+
+	return nil
+}
+
+// serveStatic serves file of the catch-all parameter in static dir
+func (r *HttpRoute) serveStatic(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+	name := ""
+	if len(ps) > 0 {
+		name = ps[len(ps)-1].Value
+	}
+	req = req.Clone(req.Context())
+	req.URL.Path = "/" + strings.TrimPrefix(name, "/")
+	r.static.ServeHTTP(w, req)
+}
@@ -0,0 +1,155 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBodyFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "fixtures"), 0755)
+	os.MkdirAll(filepath.Join(dir, "public", "css"), 0755)
+	os.WriteFile(filepath.Join(dir, "fixtures", "report.json"), []byte(`{"total": 1}`), 0644)
+	os.WriteFile(filepath.Join(dir, "fixtures", "user-1.txt"), []byte("hello ${name}"), 0644)
+	os.WriteFile(filepath.Join(dir, "public", "css", "site.css"), []byte("body { margin: 0 }"), 0644)
+	file := filepath.Join(dir, "http-mock.yml")
+	os.WriteFile(file, []byte(`
+default:
+  code: 404
+  bodyFile: fixtures/report.json
+routes:
+  - uri: /report
+    response:
+      bodyFile: fixtures/report.json
+  - uri: /users/:id
+    response:
+      bodyFile: fixtures/user-${id}.txt
+      template: true
+  - uri: /files
+    response:
+      bodyFile: fixtures/${file}
+  - uri: /pixel
+    response:
+      bodyBase64: R0lGODlhAQABAAAAACw=
+  - uri: /assets/*filepath
+    static: public
+`), 0644)
+	s := NewHttpServer()
+	if err := s.loadConfig(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	do := func(uri string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", uri+"?name=world", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	Convey("serve body file relative to config file", t, func() {
+		w := do("/report", nil)
+		So(w.Code, ShouldEqual, 200)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "application/json")
+		So(w.Body.String(), ShouldEqual, `{"total": 1}`)
+		So(do("/none", nil).Body.String(), ShouldEqual, `{"total": 1}`)
+	})
+
+	Convey("serve templated body file", t, func() {
+		w := do("/users/1", nil)
+		So(w.Header().Get("Content-Type"), ShouldStartWith, "text/plain")
+		So(w.Body.String(), ShouldEqual, "hello world")
+		So(do("/users/2", nil).Code, ShouldEqual, 404)
+	})
+
+	Convey("keep templated body file under its dir", t, func() {
+		file := func(name string) int {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest("GET", "/files?file="+url.QueryEscape(name), nil))
+			return w.Code
+		}
+		So(file("report.json"), ShouldEqual, 200)
+		So(file("../fixtures/report.json"), ShouldEqual, 200)
+		So(file("none.json"), ShouldEqual, 404)
+		So(file("../http-mock.yml"), ShouldEqual, 403)
+		So(file("/../../../../etc/passwd"), ShouldEqual, 403)
+		So(fileRoot("/cfg/fixtures/user-${id}.txt"), ShouldEqual, "/cfg/fixtures")
+		So(fileRoot("${file}"), ShouldEqual, ".")
+	})
+
+	Convey("serve base64 body", t, func() {
+		w := do("/pixel", nil)
+		So(w.Header().Get("Content-Type"), ShouldEqual, "image/gif")
+		So(w.Body.Bytes()[:6], ShouldResemble, []byte("GIF89a"))
+	})
+
+	Convey("serve static directory", t, func() {
+		w := do("/assets/css/site.css", nil)
+		So(w.Code, ShouldEqual, 200)
+		So(w.Header().Get("Content-Type"), ShouldStartWith, "text/css")
+		So(w.Body.String(), ShouldEqual, "body { margin: 0 }")
+		lastModified := w.Header().Get("Last-Modified")
+		So(lastModified, ShouldNotBeEmpty)
+
+		w = do("/assets/css/site.css", map[string]string{"Range": "bytes=0-3"})
+		So(w.Code, ShouldEqual, http.StatusPartialContent)
+		So(w.Body.String(), ShouldEqual, "body")
+
+		w = do("/assets/css/site.css", map[string]string{"If-Modified-Since": lastModified})
+		So(w.Code, ShouldEqual, http.StatusNotModified)
+
+		So(do("/assets/none.css", nil).Code, ShouldEqual, 404)
+	})
+
+	Convey("pick up body file changes on reload", t, func() {
+		So(s.watchedFiles(), ShouldContain, filepath.Join(dir, "fixtures", "report.json"))
+		os.WriteFile(filepath.Join(dir, "fixtures", "report.json"), []byte(`{"total": 2}`), 0644)
+		So(do("/report", nil).Body.String(), ShouldEqual, `{"total": 1}`)
+		So(s.ResetRoutes(), ShouldBeNil)
+		So(do("/report", nil).Body.String(), ShouldEqual, `{"total": 2}`)
+	})
+
+	Convey("pick up static files without reload", t, func() {
+		os.WriteFile(filepath.Join(dir, "public", "new.txt"), []byte("new"), 0644)
+		So(do("/assets/new.txt", nil).Body.String(), ShouldEqual, "new")
+	})
+
+	Convey("check body sources", t, func() {
+		for _, cfg := range []string{
+			"routes:\n  - uri: /a\n    response: {body: a, bodyFile: a.txt}\n",
+			"routes:\n  - uri: /a\n    response: {bodyFile: none.txt}\n",
+			"routes:\n  - uri: /a\n    response: {bodyBase64: '***'}\n",
+			"routes:\n  - uri: /a\n    static: " + dir + "\n",
+			"routes:\n  - uri: /a/*path\n    static: none\n",
+			"default: {bodyFile: none.txt}\n",
+		} {
+			s := NewHttpServer()
+			So(s.Load([]byte(cfg)), ShouldBeNil)
+			So(s.initRoutes(), ShouldNotBeNil)
+		}
+	})
+
+	Convey("compile response into new values", t, func() {
+		r := &HttpResponse{Code: 200, Body: "a", Headers: map[string]string{"X-A": "a"}}
+		So(r.compile(), ShouldBeNil)
+		compiled := r.compiled
+		r.Body = "{{.a}"
+		So(r.compile(), ShouldNotBeNil)
+		So(r.compiled, ShouldEqual, compiled)
+		r.Body = "b"
+		So(r.compile(), ShouldBeNil)
+		So(r.compiled, ShouldNotEqual, compiled)
+		So(compiled.body.text, ShouldEqual, "a")
+		So(compiled.headers, ShouldHaveLength, 1)
+	})
+}
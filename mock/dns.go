@@ -0,0 +1,711 @@
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gookit/slog"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// dns-mock.yaml example
+//
+
+const (
+	defaultDNSPort     = 53
+	defaultDNSProtocol = "udp4"
+	defaultParentDNS   = "223.5.5.5:53" // aliyun public DNS
+)
+
+var dnsClient = &dns.Client{Net: "udp"}
+
+type dnsMap map[uint16]map[string][]dns.RR // {rrtype: {fqdn: [{ip, ttl}]}}
+
+func (c dnsMap) Get(dnsType uint16, record string) ([]dns.RR, error) {
+	typeMap, exists := c[dnsType]
+	if !exists {
+		return nil, fmt.Errorf("%s 404 not found", record)
+	}
+	result, exists := typeMap[record]
+	if !exists {
+		return nil, fmt.Errorf("%s 404 not found", record)
+	}
+	return result, nil
+}
+
+func (c dnsMap) Set(dnsType uint16, key string, value []dns.RR) {
+	typeMap, exists := c[dnsType]
+	if !exists {
+		c[dnsType] = map[string][]dns.RR{}
+		typeMap = c[dnsType]
+	}
+
+	typeMap[key] = value
+}
+
+type DNSServer struct {
+	Protocol  string       `yaml:"protocol"`
+	Port      int          `yaml:"port"`
+	ParentDNS string       `yaml:"parent"`
+	Routes    []*Record    `yaml:"routes"`
+	Record    *DNSRecorder `yaml:"record"` // record mode, forward all queries to parent DNS
+	Include   []string     `yaml:"include"`
+
+	OnReload func(err error) `yaml:"-"` // called after each hot reload
+
+	server   *dns.Server
+	started  bool         // server is listening, so port or protocol change rebinds
+	table    atomic.Value // *dnsTable
+	w        *FileWatcher
+	cfgFile  string
+	cfgData  []byte     // config data if not loaded from file
+	dir      string     // config file dir
+	mu       sync.Mutex // serializes routes update
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+type Record struct {
+	Rrtype string `yaml:"rrtype"`
+	Fqdn   string `yaml:"fqdn"`
+	Ip     string `yaml:"ip"`
+	Ttl    uint32 `yaml:"ttl"`
+
+	file string // config file and line of record, for error message
+	line int
+}
+
+func (r *Record) UnmarshalYAML(node *yaml.Node) error {
+	type plain Record
+	if err := node.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	r.line = node.Line
+
+	return nil
+}
+
+// dnsTable is the active records and parent DNS, swapped as a whole, so that
+// in-flight queries finish on the table they started with
+type dnsTable struct {
+	m      dnsMap
+	parent string
+}
+
+func NewDNSServer() *DNSServer {
+	return &DNSServer{}
+}
+
+func (s *DNSServer) Init(cfgFile string) error {
+	s.cfgFile = cfgFile
+	if err := s.loadConfig(cfgFile); err != nil {
+		return err
+	}
+	if err := s.setup(); err != nil {
+		return err
+	}
+
+	// add config watcher and hot reload
+	s.w = NewFileWatcher()
+	s.w.OnReload = s.OnReload
+	if err := s.w.Watch(cfgFile, func() error {
+		return s.ResetRoutes()
+	}); err != nil {
+		return err
+	}
+
+	return s.w.Include(s.Include...)
+}
+
+func (s *DNSServer) loadConfig(cfgFile string) error {
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return err
+	}
+	s.cfgFile = cfgFile
+	s.dir = filepath.Dir(cfgFile)
+
+	return s.Load(data)
+}
+
+// Load loads config from YAML data
+func (s *DNSServer) Load(data []byte) error {
+	if err := s.parse(data); err != nil {
+		return err
+	}
+
+	return s.validate()
+}
+
+// parse decodes config and includes of YAML data without validating
+func (s *DNSServer) parse(data []byte) error {
+	if err := yaml.Unmarshal(data, s); err != nil {
+		if s.cfgFile != "" {
+			return fmt.Errorf("%s: %v", s.cfgFile, err)
+		}
+		return err
+	}
+	if err := nullItems(data, s.cfgFile); err != nil {
+		return err
+	}
+	if s.cfgFile == "" {
+		s.cfgData = data
+	}
+	for _, r := range s.Routes {
+		r.file = s.cfgFile
+	}
+	for idx, f := range s.Include {
+		s.Include[idx] = resolvePath(s.dir, f)
+		data, err := os.ReadFile(s.Include[idx])
+		if err != nil {
+			return err
+		}
+		var c DNSServer
+		if err := yaml.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("%s: %v", s.Include[idx], err)
+		}
+		if err := nullItems(data, s.Include[idx]); err != nil {
+			return err
+		}
+		for _, r := range c.Routes {
+			r.file = s.Include[idx]
+		}
+		s.Routes = append(s.Routes, c.Routes...)
+	}
+
+	return nil
+}
+
+// validate checks config and fills defaults, all errors are returned
+func (s *DNSServer) validate() error {
+	if s.Protocol == "" {
+		slog.Warnf("protocol is not set, use default protocol: %s", defaultDNSProtocol)
+		s.Protocol = defaultDNSProtocol
+	}
+	if s.Port == 0 {
+		slog.Warnf("port is not set, use default port: %d", defaultDNSPort)
+		s.Port = defaultDNSPort
+	}
+	if s.ParentDNS == "" {
+		slog.Warnf("parentdns is not set, use default parent: %s", defaultParentDNS)
+		s.ParentDNS = defaultParentDNS
+	}
+	var errs configErrors
+	switch s.Protocol {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+	default:
+		errs = append(errs, fmt.Errorf("unsupported protocol: %s", s.Protocol))
+	}
+	if s.Port < 0 || s.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid port: %d", s.Port))
+	}
+	for idx, r := range s.Routes {
+		if r == nil {
+			errs = append(errs, fmt.Errorf("record %d is empty", idx))
+			continue
+		}
+		r.normalize()
+	}
+
+	return errs.Err()
+}
+
+// Check loads and validates config of cfgFile without binding ports, and
+// reports all errors of config and records
+func (s *DNSServer) Check(cfgFile string) error {
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return err
+	}
+	s.cfgFile = cfgFile
+	s.dir = filepath.Dir(cfgFile)
+	if err := s.parse(data); err != nil {
+		return err
+	}
+
+	var errs configErrors
+	if err := s.validate(); err != nil {
+		errs = errs.add(err)
+	}
+	if _, err := newDNSMap(s.Routes); err != nil {
+		errs = errs.add(err)
+	}
+	if _, _, err := net.SplitHostPort(s.ParentDNS); err != nil {
+		errs = append(errs, fmt.Errorf("%s: invalid parent DNS: %v", cfgFile, err))
+	}
+
+	return errs.Err()
+}
+
+// setup builds records and server of loaded config
+func (s *DNSServer) setup() error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	s.server = s.newServer(s.Protocol, s.Port)
+	s.done = make(chan struct{})
+
+	// init routes (in memory)
+	if err := s.initRoutes(); err != nil {
+		return err
+	}
+	if s.Record != nil {
+		if err := s.Record.init(); err != nil {
+			return err
+		}
+		slog.Infof("record mode, forward all queries to %s", s.ParentDNS)
+	}
+
+	return nil
+}
+
+func (s *DNSServer) newServer(protocol string, port int) *dns.Server {
+	return &dns.Server{Addr: fmt.Sprintf(":%d", port), Net: protocol, Handler: dns.HandlerFunc(s.handle)}
+}
+
+// normalize adds "." as suffix of FQDN
+func (r *Record) normalize() {
+	if !strings.HasSuffix(r.Fqdn, ".") {
+		r.Fqdn += "."
+	}
+}
+
+func (s *DNSServer) initRoutes() error {
+	m, err := newDNSMap(s.Routes)
+	if err != nil {
+		return err
+	}
+	s.table.Store(&dnsTable{m: m, parent: s.ParentDNS})
+
+	return nil
+}
+
+// active returns the active table
+func (s *DNSServer) active() *dnsTable {
+	t, _ := s.table.Load().(*dnsTable)
+	if t == nil {
+		return &dnsTable{m: dnsMap{}, parent: s.ParentDNS}
+	}
+
+	return t
+}
+
+// newDNSMap builds dns map of routes, all record errors are returned
+func newDNSMap(routes []*Record) (dnsMap, error) {
+	m := dnsMap{}
+	var errs configErrors
+	for _, r := range routes {
+		slog.Infof("add mock DNS: %s %s", r.Rrtype, r.Fqdn)
+		rrType, rrs, err := r.rrs()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.Set(rrType, r.Fqdn, rrs)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// rrs returns DNS type and resource records of record
+func (r *Record) rrs() (uint16, []dns.RR, error) {
+	switch r.Rrtype {
+	case "A":
+		ips := strings.Split(r.Ip, ",")
+		rrs := make([]dns.RR, len(ips))
+		for idx, ip := range ips {
+			realIp := net.ParseIP(ip)
+			if realIp == nil {
+				return 0, nil, newConfigError(r.file, r.line, "invalid ip addr: %s", ip)
+			}
+			rrs[idx] = &dns.A{
+				Hdr: dns.RR_Header{
+					Name:   r.Fqdn,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    r.Ttl,
+				},
+				A: realIp,
+			}
+		}
+		return dns.TypeA, rrs, nil
+	case "CNAME":
+		return 0, nil, newConfigError(r.file, r.line, "CNAME is not supported yet")
+	}
+
+	return 0, nil, newConfigError(r.file, r.line, "unsupported DNS type: %s", r.Rrtype)
+}
+
+// updateRoutes applies fn to a copy of current routes, and swaps in the new
+// routes only if all records are valid
+func (s *DNSServer) updateRoutes(fn func([]*Record) ([]*Record, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	routes, err := fn(append([]*Record{}, s.Routes...))
+	if err != nil {
+		return err
+	}
+	m, err := newDNSMap(routes)
+	if err != nil {
+		return err
+	}
+	s.Routes = routes
+	s.table.Store(&dnsTable{m: m, parent: s.active().parent})
+
+	return nil
+}
+
+func (s *DNSServer) ListRoutes() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Record{}, s.Routes...)
+}
+
+func (s *DNSServer) AddRoute(data []byte) error {
+	record, err := parseRecord(data)
+	if err != nil {
+		return err
+	}
+
+	return s.updateRoutes(func(routes []*Record) ([]*Record, error) {
+		return append(routes, record), nil
+	})
+}
+
+func (s *DNSServer) UpdateRoute(idx int, data []byte) error {
+	record, err := parseRecord(data)
+	if err != nil {
+		return err
+	}
+
+	return s.updateRoutes(func(routes []*Record) ([]*Record, error) {
+		if idx < 0 || idx >= len(routes) {
+			return nil, fmt.Errorf("record %d does not exist", idx)
+		}
+		routes[idx] = record
+		return routes, nil
+	})
+}
+
+func (s *DNSServer) DeleteRoute(idx int) error {
+	return s.updateRoutes(func(routes []*Record) ([]*Record, error) {
+		if idx < 0 || idx >= len(routes) {
+			return nil, fmt.Errorf("record %d does not exist", idx)
+		}
+		return append(routes[:idx], routes[idx+1:]...), nil
+	})
+}
+
+func (s *DNSServer) SetRoutes(data []byte) error {
+	var routes []*Record
+	if err := yaml.Unmarshal(data, &routes); err != nil {
+		return err
+	}
+	if err := nullItems(data, ""); err != nil {
+		return err
+	}
+	for _, r := range routes {
+		r.normalize()
+	}
+
+	return s.updateRoutes(func([]*Record) ([]*Record, error) {
+		return routes, nil
+	})
+}
+
+// ResetRoutes reloads routes, parent DNS, port and protocol from cfg file, or
+// cfg data if not loaded from file
+func (s *DNSServer) ResetRoutes() error {
+	c, err := s.reload()
+	if err != nil {
+		return err
+	}
+
+	return s.reset(c)
+}
+
+// prepareReset loads and checks a new copy of config, and returns func which
+// swaps it in, so that servers are reset together only if all configs are valid
+func (s *DNSServer) prepareReset() (func() error, error) {
+	c, err := s.reload()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := newDNSMap(c.Routes); err != nil {
+		return nil, err
+	}
+
+	return func() error { return s.reset(c) }, nil
+}
+
+// reset applies reloaded config c, and watches its files
+func (s *DNSServer) reset(c *DNSServer) error {
+	if err := s.apply(c); err != nil {
+		return err
+	}
+	if s.w != nil {
+		return s.w.Include(c.Include...)
+	}
+
+	return nil
+}
+
+// apply swaps in records, parent DNS, port and protocol of c. The new port is
+// bound before anything changes, and the old server is stopped after.
+func (s *DNSServer) apply(c *DNSServer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := newDNSMap(c.Routes)
+	if err != nil {
+		return err
+	}
+	if s.started && (c.Port != s.Port || c.Protocol != s.Protocol) {
+		server := s.newServer(c.Protocol, c.Port)
+		if _, err := listen(server, server.Addr); err != nil {
+			return err
+		}
+		if err := activate(server); err != nil {
+			unlisten(server)
+			return err
+		}
+		old := s.server
+		s.server = server
+		go func() {
+			slog.Infof("port or protocol changed, shutting down server on %s/%s", old.Addr, old.Net)
+			old.Shutdown()
+		}()
+	}
+	if !s.started && s.server != nil {
+		s.server.Addr, s.server.Net = fmt.Sprintf(":%d", c.Port), c.Protocol
+	}
+
+	s.Routes = c.Routes
+	s.ParentDNS = c.ParentDNS
+	s.Port, s.Protocol, s.Include = c.Port, c.Protocol, c.Include
+	s.table.Store(&dnsTable{m: m, parent: c.ParentDNS})
+
+	return nil
+}
+
+// reload loads a new copy of config
+func (s *DNSServer) reload() (*DNSServer, error) {
+	c := &DNSServer{}
+	switch {
+	case s.cfgFile != "":
+		if err := c.loadConfig(s.cfgFile); err != nil {
+			return nil, err
+		}
+	case s.cfgData != nil:
+		if err := c.Load(s.cfgData); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("server is not loaded from config")
+	}
+
+	return c, nil
+}
+
+// parseRecord parses a record from YAML or JSON data
+func parseRecord(data []byte) (*Record, error) {
+	var record Record
+	if err := yaml.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	if record.Fqdn == "" {
+		return nil, errors.New("fqdn is not set")
+	}
+	record.normalize()
+
+	return &record, nil
+}
+
+// handle hijacks all dns requests, and forwards unknown ones to parent DNS
+func (s *DNSServer) handle(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+	e := &JournalEntry{
+		Time:     time.Now(),
+		Protocol: "dns",
+		Remote:   w.RemoteAddr().String(),
+		Fqdn:     q.Name,
+		Qtype:    dns.TypeToString[q.Qtype],
+	}
+	defer func() {
+		e.Latency = float64(time.Since(e.Time).Microseconds()) / 1000
+		RequestJournal.Add(e)
+	}()
+
+	t := s.active()
+	rrs, err := s.lookup(t, q)
+	if err != nil {
+		slog.Warnf("handle request %v error: %v", q, err)
+		slog.Warnf("forward request %s to parent DNS", q.Name)
+		resp, _, err := dnsClient.Exchange(r, t.parent)
+		if err != nil {
+			slog.Errorf("forward client %s request %s to parent DNS error: %v", w.RemoteAddr(), q.Name, err)
+			e.Response = &JournalResponse{Rcode: dns.RcodeToString[dns.RcodeServerFailure]}
+			dns.HandleFailed(w, r)
+			return
+		}
+		e.Response = newDNSJournalResponse(resp)
+		if s.Record != nil {
+			s.Record.Add(resp)
+		}
+		if err = w.WriteMsg(resp); err != nil {
+			slog.Errorf("write response msg error: %v", err)
+		}
+		return
+	}
+
+	m := new(dns.Msg)
+	m.Authoritative = true
+	m.SetReply(r)
+	m.Answer = rrs
+	e.Route = e.Qtype + " " + q.Name
+	e.Response = newDNSJournalResponse(m)
+	w.WriteMsg(m)
+}
+
+func (s *DNSServer) lookup(t *dnsTable, q dns.Question) ([]dns.RR, error) {
+	if s.Record != nil {
+		return nil, errors.New("record mode")
+	}
+
+	return t.m.Get(q.Qtype, q.Name)
+}
+
+// Serve serves on configured port until Shutdown
+func (s *DNSServer) Serve(wg *sync.WaitGroup) error {
+	defer wg.Done()
+
+	if _, err := s.Start(""); err != nil {
+		return err
+	}
+	<-s.done
+
+	return nil
+}
+
+// Start serves in background on addr, or on configured port if addr is empty.
+// Use port 0 in addr (eg. "127.0.0.1:0") to listen on an ephemeral port.
+func (s *DNSServer) Start(addr string) (net.Addr, error) {
+	if s.server == nil {
+		if err := s.setup(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if addr == "" {
+		addr = s.server.Addr
+	}
+	localAddr, err := listen(s.server, addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := activate(s.server); err != nil {
+		unlisten(s.server)
+		return nil, err
+	}
+	s.started = true
+
+	return localAddr, nil
+}
+
+// listen binds server to addr with its protocol
+func listen(server *dns.Server, addr string) (net.Addr, error) {
+	if strings.HasPrefix(server.Net, "udp") {
+		pc, err := net.ListenPacket(server.Net, addr)
+		if err != nil {
+			return nil, err
+		}
+		server.PacketConn = pc
+		return pc.LocalAddr(), nil
+	}
+	l, err := net.Listen(server.Net, addr)
+	if err != nil {
+		return nil, err
+	}
+	server.Listener = l
+
+	return l.Addr(), nil
+}
+
+// unlisten closes listener bound by listen, for server failed to activate
+func unlisten(server *dns.Server) {
+	if server.PacketConn != nil {
+		server.PacketConn.Close()
+	}
+	if server.Listener != nil {
+		server.Listener.Close()
+	}
+}
+
+// activate serves on bound listener in background, and waits until started
+func activate(server *dns.Server) error {
+	started := make(chan struct{})
+	errc := make(chan error, 1)
+	server.NotifyStartedFunc = func() { close(started) }
+	go func() {
+		errc <- server.ActivateAndServe()
+	}()
+	select {
+	case <-started:
+	case err := <-errc:
+		return err
+	}
+	if server.PacketConn != nil {
+		slog.Infof("start DNS server on %s/%s", server.PacketConn.LocalAddr(), server.Net)
+	} else {
+		slog.Infof("start DNS server on %s/%s", server.Listener.Addr(), server.Net)
+	}
+
+	return nil
+}
+
+func (s *DNSServer) Shutdown() error {
+	if s.w != nil {
+		s.w.Stop()
+	}
+	s.mu.Lock()
+	server, started, done := s.server, s.started, s.done
+	s.started = false
+	s.mu.Unlock()
+	if server == nil { // not set up
+		return nil
+	}
+	var err error
+	if started { // set up by Init but not started otherwise
+		err = server.Shutdown()
+	}
+	if s.Record != nil {
+		if err := s.Record.Save(); err != nil {
+			slog.Errorf("save recorded records error: %v", err)
+		}
+	}
+	if done != nil {
+		s.stopOnce.Do(func() { close(done) })
+	}
+
+	return err
+}
+
+func init() {
+	ServerMap.Add("dns", func() Server { return NewDNSServer() })
+}
@@ -0,0 +1,162 @@
+package mock
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDNSServer(t *testing.T) {
+	s := NewDNSServer()
+	s.Init("../examples/dns-mock.yml")
+	if _, err := s.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+	client := dns.Client{Net: "udp4"}
+
+	Convey("parse cfg file", t, func() {
+		So(s.Port, ShouldEqual, 2053)
+		So(s.Protocol, ShouldEqual, "udp4")
+		So(s.ParentDNS, ShouldEqual, "114.114.114.114:53")
+		So(len(s.Routes), ShouldEqual, 2)
+	})
+
+	Convey("query hijacked A record", t, func() {
+		m1 := new(dns.Msg)
+		m1.SetQuestion("www.my.internal.", dns.TypeA)
+		r1, _, err := client.Exchange(m1, "127.0.0.1:2053")
+		So(err, ShouldBeNil)
+		So(len(r1.Answer), ShouldEqual, 2)
+
+		m2 := new(dns.Msg)
+		m2.SetQuestion("host.my.internal.", dns.TypeA)
+		r2, _, err := client.Exchange(m2, "127.0.0.1:2053")
+		So(err, ShouldBeNil)
+		So(len(r2.Answer), ShouldEqual, 1)
+	})
+
+	Convey("record queries in journal", t, func() {
+		entries := RequestJournal.Find(&JournalFilter{Fqdn: "host.my.internal"})
+		So(len(entries), ShouldBeGreaterThan, 0)
+		e := entries[len(entries)-1]
+		So(e.Route, ShouldEqual, "A host.my.internal.")
+		So(e.Response.Answers, ShouldHaveLength, 1)
+	})
+}
+
+func TestStartDNSServer(t *testing.T) {
+	Convey("start server from struct on ephemeral port", t, func() {
+		s := &DNSServer{Routes: []*Record{{Rrtype: "A", Fqdn: "www.my.internal", Ip: "127.0.0.1"}}}
+		addr, err := s.Start("127.0.0.1:0")
+		So(err, ShouldBeNil)
+		t.Cleanup(func() { s.Shutdown() })
+
+		m := new(dns.Msg)
+		m.SetQuestion("www.my.internal.", dns.TypeA)
+		client := dns.Client{Net: "udp4"}
+		r, _, err := client.Exchange(m, addr.String())
+		So(err, ShouldBeNil)
+		So(len(r.Answer), ShouldEqual, 1)
+	})
+
+	Convey("shut down server not started", t, func() {
+		s := NewDNSServer()
+		So(s.Load([]byte("routes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.1\n")), ShouldBeNil)
+		So(s.Shutdown(), ShouldBeNil)
+		So((&DNSServer{}).Shutdown(), ShouldBeNil)
+
+		file := filepath.Join(t.TempDir(), "dns-mock.yml")
+		os.WriteFile(file, []byte("port: 0\nroutes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.1\n"), 0644)
+		s = NewDNSServer()
+		So(s.Init(file), ShouldBeNil)
+		So(s.Shutdown(), ShouldBeNil)
+		So(s.Shutdown(), ShouldBeNil)
+	})
+}
+
+func TestDNSServerReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dns-mock.yml")
+	os.WriteFile(file, []byte("routes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.1\n"), 0644)
+	s := NewDNSServer()
+	if err := s.Init(file); err != nil {
+		t.Fatal(err)
+	}
+	defer s.w.Stop()
+
+	Convey("keep previous records on invalid config", t, func() {
+		os.WriteFile(file, []byte("routes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.2\n  - rrtype: A\n    fqdn: bad.my.internal\n    ip: 127.0.0.300\n  - rrtype: MX\n    fqdn: mx.my.internal\n"), 0644)
+		err := s.ResetRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, file+":5: invalid ip addr: 127.0.0.300\n"+file+":8: unsupported DNS type: MX")
+		So(len(s.Routes), ShouldEqual, 1)
+		rrs, err := s.active().m.Get(dns.TypeA, "www.my.internal.")
+		So(err, ShouldBeNil)
+		So(rrs[0].(*dns.A).A.String(), ShouldEqual, "127.0.0.1")
+	})
+
+	Convey("reject null records", t, func() {
+		os.WriteFile(file, []byte("routes:\n  -\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.3\n"), 0644)
+		err := s.ResetRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, file+":2: empty item of routes")
+		So(s.SetRoutes([]byte("[null]")), ShouldNotBeNil)
+		So((&DNSServer{Routes: []*Record{nil}}).validate(), ShouldNotBeNil)
+		So(len(s.Routes), ShouldEqual, 1)
+	})
+
+	Convey("report yaml error with line", t, func() {
+		os.WriteFile(file, []byte("routes:\n  - rrtype: A\n    ttl: abc\n"), 0644)
+		err := s.ResetRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "line 3")
+		So(len(s.Routes), ShouldEqual, 1)
+	})
+}
+
+func TestDNSServerRebind(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dns-mock.yml")
+	routes := "routes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.1\n"
+	port := freePort(t)
+	os.WriteFile(file, []byte(fmt.Sprintf("protocol: udp4\nport: %d\n%s", port, routes)), 0644)
+	s := NewDNSServer()
+	if err := s.loadConfig(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+	m := new(dns.Msg)
+	m.SetQuestion("www.my.internal.", dns.TypeA)
+
+	Convey("rebind on port and protocol change", t, func() {
+		newPort := freePort(t)
+		os.WriteFile(file, []byte(fmt.Sprintf("protocol: tcp4\nport: %d\n%s", newPort, routes)), 0644)
+		So(s.ResetRoutes(), ShouldBeNil)
+		So(s.Protocol, ShouldEqual, "tcp4")
+		client := dns.Client{Net: "tcp4"}
+		r, _, err := client.Exchange(m, fmt.Sprintf("127.0.0.1:%d", newPort))
+		So(err, ShouldBeNil)
+		So(len(r.Answer), ShouldEqual, 1)
+		port = newPort
+	})
+
+	Convey("keep old port if new port fails to bind", t, func() {
+		l, err := net.Listen("tcp4", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+		busy := l.Addr().(*net.TCPAddr).Port
+		os.WriteFile(file, []byte(fmt.Sprintf("protocol: tcp4\nport: %d\n%s", busy, routes)), 0644)
+		So(s.ResetRoutes(), ShouldNotBeNil)
+		So(s.Port, ShouldEqual, port)
+		client := dns.Client{Net: "tcp4"}
+		_, _, err = client.Exchange(m, fmt.Sprintf("127.0.0.1:%d", port))
+		So(err, ShouldBeNil)
+	})
+}
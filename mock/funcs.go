@@ -0,0 +1,346 @@
+package mock
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// template functions example, usable in ${} and {{}}
+//
+// body: |
+//   id: ${uuid}
+//   code: ${randInt 1000 9999}
+//   user: ${fakeName}, ${fakeEmail}
+//   expires: ${date "RFC3339" (dateAdd "24h" now)}
+//   name: ${upper (default "guest" .name)}
+//   total: {{add .price 10}}
+
+// tplFuncs are functions of response templates, random and fake data are
+// generated from the random source, which is reproducible by SetSeed
+var tplFuncs = template.FuncMap{
+	// random and fake data
+	"uuid":          uuid,
+	"randInt":       randInt,
+	"randFloat":     randFloat,
+	"randString":    randString,
+	"randItem":      randItem,
+	"fakeFirstName": func() string { return pick(fakeFirstNames) },
+	"fakeLastName":  func() string { return pick(fakeLastNames) },
+	"fakeName":      func() string { return pick(fakeFirstNames) + " " + pick(fakeLastNames) },
+	"fakeEmail":     fakeEmail,
+	"fakeCity":      func() string { return pick(fakeCities) },
+	"fakeAddress":   fakeAddress,
+	"fakeIP":        fakeIP,
+	"fakeIPv6":      fakeIPv6,
+
+	// dates
+	"now":     time.Now,
+	"date":    date,
+	"dateAdd": dateAdd,
+	"unix":    func(t time.Time) int64 { return t.Unix() },
+
+	// encoding and hashing
+	"base64Encode": func(v interface{}) string { return base64.StdEncoding.EncodeToString([]byte(toString(v))) },
+	"base64Decode": func(v interface{}) (string, error) {
+		data, err := base64.StdEncoding.DecodeString(toString(v))
+		return string(data), err
+	},
+	"urlEncode": func(v interface{}) string { return url.QueryEscape(toString(v)) },
+	"urlDecode": func(v interface{}) (string, error) { return url.QueryUnescape(toString(v)) },
+	"hexEncode": func(v interface{}) string { return hex.EncodeToString([]byte(toString(v))) },
+	"hexDecode": func(v interface{}) (string, error) {
+		data, err := hex.DecodeString(toString(v))
+		return string(data), err
+	},
+	"sha256": func(v interface{}) string {
+		sum := sha256.Sum256([]byte(toString(v)))
+		return hex.EncodeToString(sum[:])
+	},
+	"hmacSha256": func(key interface{}, v interface{}) string {
+		h := hmac.New(sha256.New, []byte(toString(key)))
+		h.Write([]byte(toString(v)))
+		return hex.EncodeToString(h.Sum(nil))
+	},
+	"jsonEscape": jsonEscape,
+	"toJson":     toJSON,
+
+	// strings and values
+	"upper":   func(v interface{}) string { return strings.ToUpper(toString(v)) },
+	"lower":   func(v interface{}) string { return strings.ToLower(toString(v)) },
+	"default": defaultValue,
+
+	// arithmetic, integers are kept if all operands are integers
+	"add": func(a interface{}, b interface{}) (interface{}, error) { return arith(a, b, '+') },
+	"sub": func(a interface{}, b interface{}) (interface{}, error) { return arith(a, b, '-') },
+	"mul": func(a interface{}, b interface{}) (interface{}, error) { return arith(a, b, '*') },
+	"div": func(a interface{}, b interface{}) (interface{}, error) { return arith(a, b, '/') },
+	"mod": func(a interface{}, b interface{}) (interface{}, error) { return arith(a, b, '%') },
+}
+
+// isGenerator reports whether name is a function without arguments, which is
+// called by bare name like ${uuid}
+func isGenerator(name string) bool {
+	f := reflect.ValueOf(tplFuncs[name])
+
+	return f.Kind() == reflect.Func && f.Type().NumIn() == 0
+}
+
+// paramOr returns param name of data if set, otherwise calls generator name,
+// so that ${uuid} is param uuid of route /users/:uuid
+func paramOr(data interface{}, name string) (interface{}, error) {
+	if params, ok := data.(map[string]interface{}); ok {
+		if v, ok := params[name]; ok {
+			return v, nil
+		}
+	}
+	out := reflect.ValueOf(tplFuncs[name]).Call(nil)
+	if len(out) > 1 && !out[1].IsNil() {
+		return nil, out[1].Interface().(error)
+	}
+
+	return out[0].Interface(), nil
+}
+
+var (
+	fakeFirstNames = []string{"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda", "David", "Elizabeth", "Wei", "Yuki", "Amit", "Fatima", "Lucas", "Sofia"}
+	fakeLastNames  = []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Martinez", "Lee", "Wang", "Tanaka", "Patel", "Khan", "Silva", "Rossi"}
+	fakeStreets    = []string{"Main St", "Oak Ave", "Pine Rd", "Maple Dr", "Cedar Ln", "Elm St", "Park Ave", "Lake Rd"}
+	fakeCities     = []string{"Springfield", "Riverside", "Fairview", "Madison", "Georgetown", "Franklin", "Clinton", "Salem"}
+	fakeDomains    = []string{"example.com", "example.net", "example.org"}
+)
+
+// dateLayouts are named layouts of date
+var dateLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC822":      time.RFC822,
+	"Kitchen":     time.Kitchen,
+	"DateTime":    "2006-01-02 15:04:05",
+	"DateOnly":    "2006-01-02",
+	"TimeOnly":    "15:04:05",
+}
+
+func pick(items []string) string {
+	return items[random.Intn(len(items))]
+}
+
+// uuid returns a version 4 UUID
+func uuid() string {
+	b := make([]byte, 16)
+	for idx := range b {
+		b[idx] = byte(random.Intn(256))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// randInt returns random integer in [min, max]
+func randInt(min int, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("randInt: max %d is less than min %d", max, min)
+	}
+
+	return min + random.Intn(max-min+1), nil
+}
+
+// randFloat returns random float in [min, max)
+func randFloat(min float64, max float64) float64 {
+	return min + random.Float64()*(max-min)
+}
+
+const randChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randString returns random alphanumeric string of length n
+func randString(n int) string {
+	b := make([]byte, n)
+	for idx := range b {
+		b[idx] = randChars[random.Intn(len(randChars))]
+	}
+
+	return string(b)
+}
+
+func randItem(items ...interface{}) (interface{}, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("randItem: no items")
+	}
+
+	return items[random.Intn(len(items))], nil
+}
+
+func fakeEmail() string {
+	return strings.ToLower(pick(fakeFirstNames)+"."+pick(fakeLastNames)) + "@" + pick(fakeDomains)
+}
+
+func fakeAddress() string {
+	return fmt.Sprintf("%d %s, %s", 1+random.Intn(9999), pick(fakeStreets), pick(fakeCities))
+}
+
+func fakeIP() string {
+	return fmt.Sprintf("%d.%d.%d.%d", 1+random.Intn(223), random.Intn(256), random.Intn(256), 1+random.Intn(254))
+}
+
+func fakeIPv6() string {
+	parts := make([]string, 8)
+	parts[0] = "2001"
+	parts[1] = "db8" // documentation prefix
+	for idx := 2; idx < len(parts); idx++ {
+		parts[idx] = strconv.FormatInt(int64(random.Intn(0x10000)), 16)
+	}
+
+	return strings.Join(parts, ":")
+}
+
+// date formats t by Go layout or name of dateLayouts, "unix" for seconds
+func date(layout string, t time.Time) string {
+	if layout == "unix" {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	if l, ok := dateLayouts[layout]; ok {
+		layout = l
+	}
+
+	return t.Format(layout)
+}
+
+// dateAdd adds offset to t, offset is a Go duration with optional days, eg.
+// "-2d", "1d12h" or "90m"
+func dateAdd(offset string, t time.Time) (time.Time, error) {
+	days := 0
+	if d, rest, ok := strings.Cut(offset, "d"); ok {
+		n, err := strconv.Atoi(d)
+		if err != nil {
+			return t, fmt.Errorf("dateAdd: invalid offset %s", offset)
+		}
+		days = n
+		if rest == "" {
+			return t.AddDate(0, 0, days), nil
+		}
+		if strings.HasPrefix(d, "-") && !strings.HasPrefix(rest, "-") {
+			rest = "-" + rest
+		}
+		offset = rest
+	}
+	dur, err := time.ParseDuration(offset)
+	if err != nil {
+		return t, fmt.Errorf("dateAdd: %v", err)
+	}
+
+	return t.AddDate(0, 0, days).Add(dur), nil
+}
+
+// jsonEscape escapes v to be embedded in a JSON string
+func jsonEscape(v interface{}) string {
+	data, _ := json.Marshal(toString(v))
+
+	return string(data[1 : len(data)-1])
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := MarshalJSON(v)
+
+	return string(data), err
+}
+
+// defaultValue returns value, or def if value is empty
+func defaultValue(def interface{}, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+	if v := reflect.ValueOf(value); v.IsZero() || ((v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.Len() == 0) {
+		return def
+	}
+
+	return value
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+
+	return fmt.Sprint(v)
+}
+
+// toNumber converts v to int64 if it is an integer, or float64
+func toNumber(v interface{}) (int64, float64, bool, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), float64(n), true, nil
+	case int64:
+		return n, float64(n), true, nil
+	case float64:
+		return int64(n), n, n == float64(int64(n)) && !strings.ContainsAny(fmt.Sprint(n), ".e"), nil
+	}
+	s := toString(v)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, float64(i), true, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("%v is not a number", v)
+	}
+
+	return int64(f), f, false, nil
+}
+
+func arith(a interface{}, b interface{}, op byte) (interface{}, error) {
+	ai, af, aInt, err := toNumber(a)
+	if err != nil {
+		return nil, err
+	}
+	bi, bf, bInt, err := toNumber(b)
+	if err != nil {
+		return nil, err
+	}
+	if (op == '/' || op == '%') && bf == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	if aInt && bInt {
+		switch op {
+		case '+':
+			return ai + bi, nil
+		case '-':
+			return ai - bi, nil
+		case '*':
+			return ai * bi, nil
+		case '/':
+			if ai%bi == 0 {
+				return ai / bi, nil
+			}
+		case '%':
+			return ai % bi, nil
+		}
+	}
+	switch op {
+	case '+':
+		return af + bf, nil
+	case '-':
+		return af - bf, nil
+	case '*':
+		return af * bf, nil
+	case '%':
+		return nil, fmt.Errorf("mod of non-integer")
+	}
+
+	return af / bf, nil
+}
@@ -0,0 +1,90 @@
+package mock
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	render := func(body string, params map[string]interface{}) string {
+		s, err := renderString(body, params)
+		So(err, ShouldBeNil)
+		return s
+	}
+
+	Convey("call functions in ${} and {{}}", t, func() {
+		params := map[string]interface{}{"name": "Alice", "page": "2", "price": 1.5}
+		So(render("${upper .name} {{lower .name}}", params), ShouldEqual, "ALICE alice")
+		So(render("${.name | upper}", params), ShouldEqual, "ALICE")
+		So(render("${default \"guest\" .user} ${default \"guest\" .name}", params), ShouldEqual, "guest Alice")
+		So(render("${add .page 1} ${sub 1 .page} ${mul .price 2} ${div 7 2} ${div 6 2} ${mod 7 2}", params), ShouldEqual, "3 -1 3 3.5 3 1")
+	})
+
+	Convey("encode and hash", t, func() {
+		So(render(`${base64Encode "hi?"} ${base64Decode "aGk/"}`, nil), ShouldEqual, "aGk/ hi?")
+		So(render(`${urlEncode "a b&c"} ${urlDecode "a+b%26c"}`, nil), ShouldEqual, "a+b%26c a b&c")
+		So(render(`${hexEncode "hi"} ${hexDecode "6869"}`, nil), ShouldEqual, "6869 hi")
+		So(render(`${sha256 "abc"}`, nil), ShouldEqual, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")
+		So(render(`${hmacSha256 "key" "The quick brown fox jumps over the lazy dog"}`, nil), ShouldEqual, "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8")
+		So(render(`{"text": "${jsonEscape .text}", "items": ${toJson .items}}`, map[string]interface{}{
+			"text": "say \"hi\"\n", "items": []interface{}{1, "a"},
+		}), ShouldEqual, `{"text": "say \"hi\"\n", "items": [1,"a"]}`)
+	})
+
+	Convey("format dates with offsets", t, func() {
+		now := time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC)
+		params := map[string]interface{}{"t": now}
+		So(render(`${date "DateOnly" (dateAdd "1d" .t)}`, params), ShouldEqual, "2024-02-29")
+		So(render(`${date "RFC3339" (dateAdd "-1d12h" .t)}`, params), ShouldEqual, "2024-02-27T00:00:00Z")
+		So(render(`${date "15:04" (dateAdd "90m" .t)} ${date "unix" .t} ${unix .t}`, params), ShouldEqual, "13:30 1709121600 1709121600")
+		So(render(`${date "DateOnly" now}`, nil), ShouldEqual, time.Now().Format("2006-01-02"))
+	})
+
+	Convey("generate random and fake data", t, func() {
+		body := "${uuid} ${randInt 1 3} ${randFloat 0 1} ${randString 8} ${randItem \"a\" \"b\"} ${fakeName} ${fakeEmail} ${fakeAddress} ${fakeIP} ${fakeIPv6}"
+		SetSeed(42)
+		first := render(body, nil)
+		SetSeed(42)
+		So(render(body, nil), ShouldEqual, first)
+		So(render(body, nil), ShouldNotEqual, first)
+
+		So(render("${uuid}", nil), shouldMatch, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+		So(render("${randString 12}", nil), shouldMatch, `^[a-zA-Z0-9]{12}$`)
+		So(render("${fakeEmail}", nil), shouldMatch, `^[a-z]+\.[a-z]+@example\.(com|net|org)$`)
+		So(render("${fakeIP}", nil), shouldMatch, `^\d+\.\d+\.\d+\.\d+$`)
+		for i := 0; i < 20; i++ {
+			So(render("${randInt 1 3}", nil), ShouldBeIn, "1", "2", "3")
+		}
+	})
+
+	Convey("keep params and report errors", t, func() {
+		So(render("${name} ${request.headers.X-Id}", map[string]interface{}{
+			"name": "a", "request": map[string]interface{}{"headers": map[string]interface{}{"X-Id": "1"}},
+		}), ShouldEqual, "a 1")
+		params := map[string]interface{}{"date": "2024-01-02", "default": "d", "add": 1, "lower": "A", "unix": 5, "uuid": "u"}
+		So(render("${date} ${default} ${add} ${ lower } ${unix} ${.uuid}", params), ShouldEqual, "2024-01-02 d 1 A 5 u")
+		So(render("${uuid}", params), ShouldEqual, "u")
+		So(render(`{"id": "${uuid}"}`, params), ShouldEqual, `{"id": "u"}`)
+		object, err := newJSONTemplate(map[string]interface{}{"id": "${uuid}"})
+		So(err, ShouldBeNil)
+		data, err := object.marshal(params)
+		So(err, ShouldBeNil)
+		So(data, ShouldEqual, `{"id":"u"}`)
+		So(render("${.date | upper}", map[string]interface{}{"date": "jan"}), ShouldEqual, "JAN")
+		for _, body := range []string{"${div 1 0}", "${add .a 1}", "${randInt 3 1}", `${dateAdd "1x" now}`, `${base64Decode "***"}`} {
+			_, err := renderString(body, map[string]interface{}{"a": "x"})
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func shouldMatch(actual interface{}, expected ...interface{}) string {
+	if regexp.MustCompile(expected[0].(string)).MatchString(actual.(string)) {
+		return ""
+	}
+
+	return actual.(string) + " does not match " + expected[0].(string)
+}
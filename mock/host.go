@@ -0,0 +1,239 @@
+package mock
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/yaml.v3"
+)
+
+// virtual hosts example
+//
+// cert: default.pem # default certificate, optional if hosts have certificates
+// key: default.key
+// hosts:
+//   - host: api.partner.test
+//     routes:
+//       - uri: /api
+//   - host: "*.partner.test" # wildcard of one label, tried after exact hosts
+//     cert: partner.pem # selected by SNI name
+//     key: partner.key
+//     default:
+//       code: 404
+//     routes:
+//       - uri: /api
+// routes: # routes of unknown hosts
+//   - uri: /api
+
+// HttpHost groups routes served for requests of matching Host header
+type HttpHost struct {
+	Host     string        `yaml:"host"` // exact host, "*.domain" or "*"
+	CertFile string        `yaml:"cert,omitempty"`
+	KeyFile  string        `yaml:"key,omitempty"`
+	Default  *HttpResponse `yaml:"default,omitempty"` // response if no route of host matches
+	Proxy    []*HttpProxy  `yaml:"proxy,omitempty"`   // forward requests matching no route of host
+	Routes   []*HttpRoute  `yaml:"routes"`
+
+	file     string // config file and line of host, for error message
+	line     int
+	certLine int
+	keyLine  int
+}
+
+func (h *HttpHost) UnmarshalYAML(node *yaml.Node) error {
+	type plain HttpHost
+	if err := node.Decode((*plain)(h)); err != nil {
+		return err
+	}
+	h.line = node.Line
+	h.certLine, h.keyLine = keyLine(node, "cert"), keyLine(node, "key")
+
+	return nil
+}
+
+func (h *HttpHost) clone() *HttpHost {
+	c := *h
+	c.Default = h.Default.clone()
+	c.Routes = cloneRoutes(h.Routes)
+
+	return &c
+}
+
+func cloneHosts(hosts []*HttpHost) []*HttpHost {
+	clones := make([]*HttpHost, len(hosts))
+	for idx, h := range hosts {
+		clones[idx] = h.clone()
+	}
+
+	return clones
+}
+
+func (h *HttpHost) normalize() {
+	h.Host = strings.ToLower(h.Host)
+	for _, r := range h.Routes {
+		r.normalize()
+	}
+	h.Default.normalize()
+	for _, p := range h.Proxy {
+		p.normalize()
+	}
+}
+
+func (h *HttpHost) check() error {
+	switch {
+	case h.Host == "":
+		return newConfigError(h.file, h.line, "host is not set")
+	case strings.Contains(strings.TrimPrefix(h.Host, "*"), "*"),
+		strings.HasPrefix(h.Host, "*") && h.Host != "*" && !strings.HasPrefix(h.Host, "*."):
+		return newConfigError(h.file, h.line, "invalid host pattern: %s", h.Host)
+	}
+
+	return nil
+}
+
+// matchHost reports whether host matches pattern, "*." matches one label
+func matchHost(pattern string, host string) bool {
+	if pattern == "*" || pattern == host {
+		return true
+	}
+	if !strings.HasPrefix(pattern, "*.") {
+		return false
+	}
+	label := strings.TrimSuffix(host, pattern[1:])
+
+	return label != host && label != "" && !strings.Contains(label, ".")
+}
+
+// findHost returns index of the first pattern matching host, exact patterns
+// are tried before wildcard patterns, or -1 if none matches
+func findHost(patterns []string, host string) int {
+	for idx, p := range patterns {
+		if p == host {
+			return idx
+		}
+	}
+	for idx, p := range patterns {
+		if matchHost(p, host) {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// hostname returns lower cased host without port
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// httpTable is the active routers, swapped as a whole on routes update
+type httpTable struct {
+	hosts   []string
+	routers []*httprouter.Router // routers of hosts
+	router  *httprouter.Router   // router of unknown hosts
+}
+
+// newHTTPTable builds routers of hosts and routes, all errors are returned
+func newHTTPTable(hosts []*HttpHost, routes []*HttpRoute, fallback *HttpResponse, proxies []*HttpProxy, scenarios *scenarioStates) (*httpTable, error) {
+	t := &httpTable{}
+	var errs configErrors
+	seen := map[string]bool{}
+	for _, h := range hosts {
+		if err := h.check(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if seen[h.Host] {
+			errs = append(errs, newConfigError(h.file, h.line, "duplicated host %s", h.Host))
+			continue
+		}
+		seen[h.Host] = true
+		router, err := newRouter(h.Routes, h.Default, h.Proxy, scenarios)
+		if err != nil {
+			errs = errs.add(err)
+			continue
+		}
+		t.hosts = append(t.hosts, h.Host)
+		t.routers = append(t.routers, router)
+	}
+	router, err := newRouter(routes, fallback, proxies, scenarios)
+	if err != nil {
+		errs = errs.add(err)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	t.router = router
+
+	return t, nil
+}
+
+func (t *httpTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if idx := findHost(t.hosts, hostname(r.Host)); idx >= 0 {
+		t.routers[idx].ServeHTTP(w, r)
+		return
+	}
+	t.router.ServeHTTP(w, r)
+}
+
+// certHolder holds the certificates, which are empty if TLS is not configured
+type certHolder struct {
+	cert  *tls.Certificate // default certificate
+	hosts []string
+	certs []*tls.Certificate // certificates of hosts, selected by SNI name
+}
+
+func (h certHolder) enabled() bool {
+	return h.cert != nil || len(h.certs) > 0
+}
+
+// get returns certificate of SNI name, or the default certificate
+func (h certHolder) get(serverName string) *tls.Certificate {
+	if idx := findHost(h.hosts, hostname(serverName)); idx >= 0 {
+		return h.certs[idx]
+	}
+
+	return h.cert
+}
+
+// loadCertificates loads the default certificate and certificates of hosts
+func (s *HttpServer) loadCertificates() (certHolder, error) {
+	var h certHolder
+	var err error
+	if h.cert, err = loadCertificate(s.CertFile, s.KeyFile); err != nil {
+		return h, err
+	}
+	for _, host := range s.Hosts {
+		cert, err := loadCertificate(host.CertFile, host.KeyFile)
+		if err != nil {
+			return h, fmt.Errorf("host %s: %v", host.Host, err)
+		}
+		if cert != nil {
+			h.hosts = append(h.hosts, host.Host)
+			h.certs = append(h.certs, cert)
+		}
+	}
+
+	return h, nil
+}
+
+// loadCertificate loads certificate of cert and key file, nil if not set
+func loadCertificate(certFile string, keyFile string) (*tls.Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
@@ -0,0 +1,183 @@
+package mock
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writeCertificate writes a self-signed certificate of name to dir, and
+// returns cert and key file
+func writeCertificate(t *testing.T, dir string, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0644)
+
+	return certFile, keyFile
+}
+
+func TestMatchHost(t *testing.T) {
+	Convey("match exact and wildcard hosts", t, func() {
+		So(matchHost("api.partner.test", "api.partner.test"), ShouldBeTrue)
+		So(matchHost("*.partner.test", "api.partner.test"), ShouldBeTrue)
+		So(matchHost("*.partner.test", "partner.test"), ShouldBeFalse)
+		So(matchHost("*.partner.test", "a.api.partner.test"), ShouldBeFalse)
+		So(matchHost("*", "any.test"), ShouldBeTrue)
+	})
+
+	Convey("try exact hosts first", t, func() {
+		hosts := []string{"*.partner.test", "api.partner.test"}
+		So(findHost(hosts, "api.partner.test"), ShouldEqual, 1)
+		So(findHost(hosts, "auth.partner.test"), ShouldEqual, 0)
+		So(findHost(hosts, "other.test"), ShouldEqual, -1)
+		So(hostname("API.partner.test:8443"), ShouldEqual, "api.partner.test")
+	})
+}
+
+func TestVirtualHosts(t *testing.T) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+hosts:
+  - host: api.partner.test
+    routes:
+      - uri: /whoami
+        response:
+          body: api
+  - host: "*.partner.test"
+    default:
+      code: 404
+      body: unknown partner route
+    routes:
+      - uri: /whoami
+        response:
+          body: partner
+routes:
+  - uri: /whoami
+    response:
+      body: fallback
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+
+	doRequest := func(host string, uri string) (int, string) {
+		req := httptest.NewRequest("GET", uri, nil)
+		req.Host = host
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		body, _ := io.ReadAll(w.Result().Body)
+		return w.Code, string(body)
+	}
+
+	Convey("route by Host header", t, func() {
+		_, body := doRequest("api.partner.test", "/whoami")
+		So(body, ShouldEqual, "api")
+		_, body = doRequest("AUTH.partner.test:8443", "/whoami")
+		So(body, ShouldEqual, "partner")
+		code, body := doRequest("auth.partner.test", "/other")
+		So(code, ShouldEqual, 404)
+		So(body, ShouldEqual, "unknown partner route")
+	})
+
+	Convey("serve unknown hosts with fallback routes", t, func() {
+		_, body := doRequest("other.test", "/whoami")
+		So(body, ShouldEqual, "fallback")
+	})
+
+	Convey("report host errors with line", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("hosts:\n  - routes: []\n  - host: a.*.test\n  - host: a.test\n  - host: a.test\n")), ShouldBeNil)
+		err := s.initRoutes()
+		So(err, ShouldNotBeNil)
+		errs := err.(configErrors)
+		So(errs, ShouldHaveLength, 3)
+		So(errs[0].Error(), ShouldEqual, "line 2: host is not set")
+		So(errs[1].Error(), ShouldEqual, "line 3: invalid host pattern: a.*.test")
+		So(errs[2].Error(), ShouldEqual, "line 5: duplicated host a.test")
+	})
+}
+
+func TestSNICertificates(t *testing.T) {
+	dir := t.TempDir()
+	writeCertificate(t, dir, "default.test")
+	writeCertificate(t, dir, "api.partner.test")
+	file := filepath.Join(dir, "https-mock.yml")
+	os.WriteFile(file, []byte(`
+cert: default.test.pem
+key: default.test.key
+hosts:
+  - host: api.partner.test
+    cert: api.partner.test.pem
+    key: api.partner.test.key
+    routes:
+      - uri: /whoami
+        response:
+          body: api
+`), 0644)
+	s := NewHttpServer()
+	if err := s.loadConfig(file); err != nil {
+		t.Fatal(err)
+	}
+	addr, err := s.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+
+	serverName := func(sni string) string {
+		conn, err := tls.Dial("tcp", addr.String(), &tls.Config{ServerName: sni, InsecureSkipVerify: true})
+		if err != nil {
+			return err.Error()
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	Convey("select certificate by SNI name", t, func() {
+		So(s.URL(), ShouldStartWith, "https://")
+		So(serverName("api.partner.test"), ShouldEqual, "api.partner.test")
+		So(serverName("other.test"), ShouldEqual, "default.test")
+	})
+
+	Convey("watch certificates of hosts", t, func() {
+		So(s.watchedFiles(), ShouldContain, filepath.Join(dir, "api.partner.test.pem"))
+		So(fmt.Sprint(s.watchedFiles()), ShouldContainSubstring, "default.test.key")
+	})
+}
@@ -0,0 +1,1589 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/gookit/slog"
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/yaml.v3"
+)
+
+// http-mock.yaml example
+//
+// port: 8181
+// include: # routes of included files are appended
+//   - more-http-mock.yml
+// default: # response if no route matches, 404 if not set
+//   code: 404
+// routes:
+//   - uri: /api
+//     method: GET
+//     request: # optional matchers, routes of same method and uri are tried in order
+//       headers:
+//         X-Tenant: acme
+//     response:
+//       headers:
+//         Content-Type: plain/text
+//       body: hello world
+//   - uri: /flaky
+//     oneof: # pick one response randomly by weight, instead of response
+//       - weight: 9
+//         body: ok
+//       - weight: 1
+//         code: 503
+//   - uri: /job
+//     sequence: # serve responses in order on successive calls, instead of response
+//       responses:
+//         - code: 202
+//         - body: done
+
+const (
+	defaultHTTPPort   = 8181
+	defaultHTTPMethod = "GET"
+	defaultHTTPCode   = 200
+)
+
+type HttpServer struct {
+	Routes    []*HttpRoute      `yaml:"routes"`  // routes of hosts not listed in hosts
+	Default   *HttpResponse     `yaml:"default"` // response if no route matches
+	Hosts     []*HttpHost       `yaml:"hosts"`
+	Proxy     []*HttpProxy      `yaml:"proxy"`     // forward requests matching no route to upstream
+	Scenarios map[string]string `yaml:"scenarios"` // initial states of scenarios, default "started"
+	Port      int               `yaml:"port"`
+	CertFile  string            `yaml:"cert"`
+	KeyFile   string            `yaml:"key"`
+	Record    *HttpRecorder     `yaml:"record"` // record mode, forward requests to upstream instead of mock, not hot reloaded
+	Include   []string          `yaml:"include"`
+
+	OnReload func(err error) `yaml:"-"` // called after each hot reload
+
+	router    atomic.Value // *httpTable, swapped as a whole on routes update
+	scenarios *scenarioStates
+	cert      atomic.Value // certHolder, swapped on cert or key update
+	handler   http.Handler
+	server    *http.Server
+	listener  net.Listener
+	done      chan struct{}      // closed on shutdown
+	cancel    context.CancelFunc // cancels base context of server, to end streams on shutdown
+	stopOnce  sync.Once
+	w         *FileWatcher
+	cfgFile   string
+	cfgData   []byte     // config data if not loaded from file
+	dir       string     // config file dir
+	certLine  int        // line of cert, for error message
+	keyLine   int        // line of key, for error message
+	mu        sync.Mutex // serializes routes update
+}
+
+type HttpRoute struct {
+	Uri         string           `yaml:"uri"`
+	Method      string           `yaml:"method"`
+	Request     *HttpRequest     `yaml:"request,omitempty"`
+	Response    *HttpResponse    `yaml:"response,omitempty"`
+	Oneof       []*HttpResponse  `yaml:"oneof,omitempty"` // candidate responses picked by weight
+	Sequence    *HttpSequence    `yaml:"sequence,omitempty"`
+	Scenario    *HttpScenario    `yaml:"scenario,omitempty"`
+	Websocket   *HttpWebsocket   `yaml:"websocket,omitempty"`   // upgrade to WebSocket and run script, instead of response
+	Passthrough *HttpPassthrough `yaml:"passthrough,omitempty"` // forward to upstream and patch response, instead of response
+	Static      string           `yaml:"static,omitempty"`      // serve directory under catch-all parameter, instead of response
+
+	static http.Handler
+
+	file string // config file and line of route, for error message
+	line int
+}
+
+type HttpResponse struct {
+	Weight  *int              `yaml:"weight,omitempty"` // weight in oneof, default 1, 0 to disable
+	Code    int               `yaml:"code"`
+	Delay   int               `yaml:"delay,omitempty"` // delay in milliseconds
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    interface{}       `yaml:"body,omitempty"`
+	Stream  *HttpStream       `yaml:"stream,omitempty"` // streaming response, instead of body
+	Indent  int               `yaml:"indent,omitempty"` // indent of structured body in JSON, compact if 0
+
+	BodyFile   string `yaml:"bodyFile,omitempty"`   // body read from file, path may be templated
+	BodyBase64 string `yaml:"bodyBase64,omitempty"` // binary body in base64
+	Template   bool   `yaml:"template,omitempty"`   // render body file content as template
+
+	compiled *compiledResponse // replaced as a whole on compile, never changed in place
+}
+
+// compiledResponse is body and headers compiled from HttpResponse
+type compiledResponse struct {
+	data    []byte            // body of base64 or untemplated file
+	headers []*headerTemplate // compiled headers
+	body    *textTemplate     // compiled text body, or JSON of structured body
+	object  *jsonTemplate     // templated structured body
+	file    *textTemplate     // compiled content of untemplated body file
+	path    *textTemplate     // compiled templated body file path
+	root    string            // dir that rendered body file path must stay under
+	json    bool
+}
+
+type headerTemplate struct {
+	key   *textTemplate
+	value *textTemplate
+}
+
+// UnmarshalYAML decodes structured body keeping key order and numbers as
+// written in YAML
+func (r *HttpResponse) UnmarshalYAML(node *yaml.Node) error {
+	type plain HttpResponse
+	if err := node.Decode((*plain)(r)); err != nil {
+		return err
+	}
+
+	return yamlField(node, "body", &r.Body)
+}
+
+func (r *HttpRoute) UnmarshalYAML(node *yaml.Node) error {
+	type plain HttpRoute
+	if err := node.Decode((*plain)(r)); err != nil {
+		return err
+	}
+	r.line = node.Line
+
+	return nil
+}
+
+func NewHttpServer() *HttpServer {
+	return &HttpServer{}
+}
+
+func (s *HttpServer) Init(cfgFile string) error {
+	s.cfgFile = cfgFile
+	if err := s.loadConfig(cfgFile); err != nil {
+		return err
+	}
+	if err := s.setup(); err != nil {
+		return err
+	}
+
+	// add config watcher and hot reload
+	s.w = NewFileWatcher()
+	s.w.OnReload = s.OnReload
+	if err := s.w.Watch(cfgFile, func() error {
+		return s.ResetRoutes()
+	}); err != nil {
+		return err
+	}
+
+	return s.w.Include(s.watchedFiles()...)
+}
+
+func (s *HttpServer) loadConfig(cfgFile string) error {
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		dir, _ := os.Getwd()
+		slog.Errorf("read file error: %v, current path: %s", err, dir)
+		return err
+	}
+	s.cfgFile = cfgFile
+	s.dir = filepath.Dir(cfgFile)
+
+	return s.Load(data)
+}
+
+func (s *HttpServer) UnmarshalYAML(node *yaml.Node) error {
+	type plain HttpServer
+	if err := node.Decode((*plain)(s)); err != nil {
+		return err
+	}
+	s.certLine, s.keyLine = keyLine(node, "cert"), keyLine(node, "key")
+
+	return nil
+}
+
+// Load loads config from YAML data, relative file paths in config are
+// resolved against the config file dir if loaded by Init
+func (s *HttpServer) Load(data []byte) error {
+	if err := s.parse(data); err != nil {
+		return err
+	}
+
+	return s.validate()
+}
+
+// parse decodes config and includes of YAML data without validating
+func (s *HttpServer) parse(data []byte) error {
+	if err := yaml.Unmarshal(data, s); err != nil {
+		if s.cfgFile != "" {
+			return fmt.Errorf("%s: %v", s.cfgFile, err)
+		}
+		return err
+	}
+	if err := nullItems(data, s.cfgFile); err != nil {
+		return err
+	}
+	if s.cfgFile == "" {
+		s.cfgData = data
+	}
+	for _, r := range s.Routes {
+		r.file = s.cfgFile
+	}
+	setProxiesFile(s.Proxy, s.cfgFile)
+	s.setHostsFile(s.Hosts, s.cfgFile)
+	if s.CertFile != "" {
+		s.CertFile = resolvePath(s.dir, s.CertFile)
+	}
+	if s.KeyFile != "" {
+		s.KeyFile = resolvePath(s.dir, s.KeyFile)
+	}
+	for idx, f := range s.Include {
+		s.Include[idx] = resolvePath(s.dir, f)
+		data, err := os.ReadFile(s.Include[idx])
+		if err != nil {
+			return err
+		}
+		var c HttpServer
+		if err := yaml.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("%s: %v", s.Include[idx], err)
+		}
+		if err := nullItems(data, s.Include[idx]); err != nil {
+			return err
+		}
+		for _, r := range c.Routes {
+			r.file = s.Include[idx]
+		}
+		setProxiesFile(c.Proxy, s.Include[idx])
+		s.setHostsFile(c.Hosts, s.Include[idx])
+		s.Routes = append(s.Routes, c.Routes...)
+		s.Hosts = append(s.Hosts, c.Hosts...)
+		s.Proxy = append(s.Proxy, c.Proxy...)
+	}
+	for _, r := range s.allRoutes() {
+		if r.Static != "" {
+			r.Static = resolvePath(s.dir, r.Static)
+		}
+	}
+	for _, resp := range s.responses() {
+		if resp.BodyFile != "" {
+			resp.BodyFile = resolveBodyFile(s.dir, resp.BodyFile)
+		}
+	}
+
+	return nil
+}
+
+// allRoutes returns routes of all hosts
+func (s *HttpServer) allRoutes() []*HttpRoute {
+	routes := append([]*HttpRoute{}, s.Routes...)
+	for _, h := range s.Hosts {
+		routes = append(routes, h.Routes...)
+	}
+
+	return routes
+}
+
+// responses returns responses of all routes and default responses
+func (s *HttpServer) responses() []*HttpResponse {
+	var responses []*HttpResponse
+	for _, r := range s.allRoutes() {
+		if r != nil {
+			responses = append(responses, r.responses()...)
+		}
+	}
+	if s.Default != nil {
+		responses = append(responses, s.Default)
+	}
+	for _, h := range s.Hosts {
+		if h.Default != nil {
+			responses = append(responses, h.Default)
+		}
+	}
+
+	return responses
+}
+
+// setHostsFile sets config file of hosts and their routes, and resolves cert
+// and key paths
+func (s *HttpServer) setHostsFile(hosts []*HttpHost, file string) {
+	for _, h := range hosts {
+		h.file = file
+		for _, r := range h.Routes {
+			r.file = file
+		}
+		setProxiesFile(h.Proxy, file)
+		if h.CertFile != "" {
+			h.CertFile = resolvePath(s.dir, h.CertFile)
+		}
+		if h.KeyFile != "" {
+			h.KeyFile = resolvePath(s.dir, h.KeyFile)
+		}
+	}
+}
+
+func setProxiesFile(proxies []*HttpProxy, file string) {
+	for _, p := range proxies {
+		if p != nil {
+			p.file = file
+		}
+	}
+}
+
+// watchedFiles returns files pulled in by config
+func (s *HttpServer) watchedFiles() []string {
+	files := append([]string{}, s.Include...)
+	if s.CertFile != "" {
+		files = append(files, s.CertFile)
+	}
+	if s.KeyFile != "" {
+		files = append(files, s.KeyFile)
+	}
+	for _, h := range s.Hosts {
+		if h.CertFile != "" {
+			files = append(files, h.CertFile)
+		}
+		if h.KeyFile != "" {
+			files = append(files, h.KeyFile)
+		}
+	}
+	for _, resp := range s.responses() {
+		if resp.BodyFile != "" && !resp.templatedFile() {
+			files = append(files, resp.BodyFile)
+		}
+	}
+
+	return files
+}
+
+// validate checks config and fills defaults, all errors are returned
+func (s *HttpServer) validate() error {
+	var errs configErrors
+	for idx, r := range s.Routes {
+		if r == nil {
+			errs = append(errs, fmt.Errorf("route %d is empty", idx))
+		}
+	}
+	for idx, h := range s.Hosts {
+		if h == nil {
+			errs = append(errs, fmt.Errorf("host %d is empty", idx))
+			continue
+		}
+		for ridx, r := range h.Routes {
+			if r == nil {
+				errs = append(errs, newConfigError(h.file, h.line, "route %d of host is empty", ridx))
+			}
+		}
+	}
+	if len(errs) > 0 { // empty items can not be normalized
+		return errs
+	}
+	if err := s.checkCertFiles(); err != nil {
+		errs = errs.add(err)
+	}
+
+	if s.Port == 0 {
+		s.Port = defaultHTTPPort
+	}
+	if s.Port < 0 || s.Port > 65535 {
+		errs = append(errs, fmt.Errorf("invalid port: %d", s.Port))
+	}
+	for _, r := range s.Routes {
+		r.normalize()
+	}
+	s.Default.normalize()
+	for _, h := range s.Hosts {
+		h.normalize()
+	}
+	for _, p := range s.Proxy {
+		p.normalize()
+	}
+
+	return errs.Err()
+}
+
+// checkCertFiles returns errors of all cert and key files not found
+func (s *HttpServer) checkCertFiles() error {
+	var errs configErrors
+	check := func(path string, file string, line int) {
+		if path == "" {
+			return
+		}
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, newConfigError(file, line, "%v", err))
+		}
+	}
+	check(s.CertFile, s.cfgFile, s.certLine)
+	check(s.KeyFile, s.cfgFile, s.keyLine)
+	for _, h := range s.Hosts {
+		check(h.CertFile, h.file, h.certLine)
+		check(h.KeyFile, h.file, h.keyLine)
+	}
+
+	return errs.Err()
+}
+
+// setup builds routes and server of loaded config
+func (s *HttpServer) setup() error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	// init routes
+	if err := s.initRoutes(); err != nil {
+		return err
+	}
+
+	certs, err := s.loadCertificates()
+	if err != nil {
+		return err
+	}
+	s.cert.Store(certs)
+
+	// init server
+	s.handler = journalHandler(RequestJournal, s)
+	if s.Record != nil {
+		if err := s.Record.init(); err != nil {
+			return err
+		}
+		slog.Infof("record mode, forward requests to %s", s.Record.Upstream)
+		s.handler = journalHandler(RequestJournal, s.Record)
+	}
+	s.server, s.cancel = s.newServer(s.Port)
+	s.done = make(chan struct{})
+
+	return nil
+}
+
+// newServer returns server on port, and cancel of its base context to end
+// streams and websockets held open
+func (s *HttpServer) newServer(port int) (*http.Server, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &http.Server{
+		Addr:        fmt.Sprintf(":%d", port),
+		Handler:     s.handler,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}, cancel
+}
+
+// certificates returns the active certificates
+func (s *HttpServer) certificates() certHolder {
+	h, _ := s.cert.Load().(certHolder)
+	return h
+}
+
+func (s *HttpServer) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert := s.certificates().get(hello.ServerName)
+	if cert == nil {
+		return nil, fmt.Errorf("no certificate configured for %s", hello.ServerName)
+	}
+
+	return cert, nil
+}
+
+// Check loads and validates config of cfgFile without binding ports, and
+// reports all errors of config and routes
+func (s *HttpServer) Check(cfgFile string) error {
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return err
+	}
+	s.cfgFile = cfgFile
+	s.dir = filepath.Dir(cfgFile)
+	if err := s.parse(data); err != nil {
+		return err
+	}
+
+	var errs configErrors
+	if err := s.validate(); err != nil { // empty items are reported by parse already
+		errs = errs.add(err)
+	}
+	for _, r := range s.allRoutes() {
+		if !supportedMethod(r.Method) {
+			errs = append(errs, newConfigError(r.file, r.line, "unsupported method %s", r.Method))
+		}
+	}
+	if _, err := newHTTPTable(s.Hosts, s.Routes, s.Default, s.Proxy, newScenarioStates(s.Scenarios)); err != nil {
+		errs = errs.add(err)
+	}
+	if s.checkCertFiles() == nil { // missing files are reported by validate
+		if _, err := s.loadCertificates(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", cfgFile, err))
+		}
+	}
+
+	return errs.Err()
+}
+
+// normalize fills route defaults
+func (r *HttpRoute) normalize() {
+	r.Method = strings.ToUpper(r.Method)
+	if r.Method == "" {
+		r.Method = defaultHTTPMethod
+	}
+	if r.Response == nil && len(r.Oneof) == 0 && r.Sequence == nil && r.Websocket == nil && r.Passthrough == nil && r.Static == "" {
+		r.Response = &HttpResponse{}
+	}
+	r.Response.normalize()
+	if r.Sequence != nil {
+		r.Sequence.normalize()
+	}
+	for _, resp := range r.Oneof {
+		resp.normalize()
+	}
+}
+
+// compile checks route and compiles its matchers
+func (r *HttpRoute) compile() error {
+	if err := r.Request.compile(); err != nil {
+		return err
+	}
+	if r.Scenario != nil {
+		if err := r.Scenario.compile(); err != nil {
+			return err
+		}
+	}
+	if r.Sequence != nil {
+		if len(r.Oneof) > 0 {
+			return errors.New("sequence and oneof can not be used together")
+		}
+		if err := r.Sequence.compile(); err != nil {
+			return err
+		}
+	}
+	total := 0
+	for idx, resp := range r.Oneof {
+		switch {
+		case resp == nil:
+			return fmt.Errorf("oneof response %d is empty", idx)
+		case resp.weight() < 0:
+			return fmt.Errorf("weight of oneof response %d is negative", idx)
+		}
+		total += resp.weight()
+	}
+	if len(r.Oneof) > 0 && total == 0 {
+		return errors.New("total weight of oneof is 0")
+	}
+	for _, resp := range r.responses() {
+		if err := resp.compile(); err != nil {
+			return err
+		}
+	}
+	if r.Websocket != nil {
+		switch {
+		case r.Response != nil || len(r.Oneof) > 0 || r.Sequence != nil:
+			return errors.New("websocket can not be used with response, oneof or sequence")
+		case r.Method != http.MethodGet:
+			return errors.New("method of websocket must be GET")
+		}
+		if err := r.Websocket.compile(); err != nil {
+			return err
+		}
+	}
+	if r.Passthrough != nil {
+		if r.Response != nil || len(r.Oneof) > 0 || r.Sequence != nil || r.Websocket != nil {
+			return errors.New("passthrough can not be used with response, oneof, sequence or websocket")
+		}
+		if err := r.Passthrough.compile(); err != nil {
+			return err
+		}
+	}
+	if r.Static != "" {
+		if r.Response != nil || len(r.Oneof) > 0 || r.Sequence != nil || r.Websocket != nil || r.Passthrough != nil {
+			return errors.New("static can not be used with response, oneof, sequence, websocket or passthrough")
+		}
+		if err := r.compileStatic(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clone returns a copy of route to be compiled, so that the route being served
+// is never changed
+func (r *HttpRoute) clone() *HttpRoute {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Request = r.Request.clone()
+	c.Response = r.Response.clone()
+	c.Oneof = cloneResponses(r.Oneof)
+	c.Sequence = r.Sequence.clone()
+	c.Websocket = r.Websocket.clone()
+	c.Passthrough = r.Passthrough.clone()
+
+	return &c
+}
+
+func cloneRoutes(routes []*HttpRoute) []*HttpRoute {
+	clones := make([]*HttpRoute, len(routes))
+	for idx, r := range routes {
+		clones[idx] = r.clone()
+	}
+
+	return clones
+}
+
+// responses returns all responses of route
+func (r *HttpRoute) responses() []*HttpResponse {
+	var responses []*HttpResponse
+	if r.Response != nil {
+		responses = append(responses, r.Response)
+	}
+	for _, resp := range r.Oneof {
+		if resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if r.Sequence != nil {
+		for _, resp := range r.Sequence.Responses {
+			if resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+	}
+
+	return responses
+}
+
+func (r *HttpResponse) clone() *HttpResponse {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Stream = r.Stream.clone()
+
+	return &c
+}
+
+func cloneResponses(responses []*HttpResponse) []*HttpResponse {
+	if responses == nil {
+		return nil
+	}
+	clones := make([]*HttpResponse, len(responses))
+	for idx, r := range responses {
+		clones[idx] = r.clone()
+	}
+
+	return clones
+}
+
+func (r *HttpResponse) compile() error {
+	c := &compiledResponse{}
+	if err := r.compileBody(c); err != nil {
+		return err
+	}
+	if err := r.compileTemplates(c); err != nil {
+		return err
+	}
+	if r.Stream != nil {
+		if err := r.Stream.compile(); err != nil {
+			return err
+		}
+	}
+	r.compiled = c
+
+	return nil
+}
+
+// pick returns index of oneof response picked randomly by weight
+func (r *HttpRoute) pick() int {
+	total := 0
+	for _, resp := range r.Oneof {
+		total += resp.weight()
+	}
+	n := random.Intn(total)
+	for idx, resp := range r.Oneof {
+		if n < resp.weight() {
+			return idx
+		}
+		n -= resp.weight()
+	}
+
+	return len(r.Oneof) - 1
+}
+
+// weight returns weight of response in oneof, 1 if not set
+func (r *HttpResponse) weight() int {
+	if r.Weight == nil {
+		return 1
+	}
+
+	return *r.Weight
+}
+
+func (r *HttpResponse) normalize() {
+	if r != nil && r.Code == 0 {
+		r.Code = defaultHTTPCode
+	}
+}
+
+func (s *HttpServer) initRoutes() error {
+	scenarios := newScenarioStates(s.Scenarios)
+	t, err := newHTTPTable(s.Hosts, s.Routes, s.Default, s.Proxy, scenarios)
+	if err != nil {
+		return err
+	}
+	s.scenarios = scenarios
+	s.router.Store(t)
+
+	return nil
+}
+
+// newRouter builds a router of routes, all route errors are returned. Routes of
+// same method and uri are tried in order, requests matching none of them are
+// served with fallback response.
+func newRouter(routes []*HttpRoute, fallback *HttpResponse, proxies []*HttpProxy, scenarios *scenarioStates) (*httprouter.Router, error) {
+	if scenarios == nil {
+		scenarios = newScenarioStates(nil)
+	}
+	router := httprouter.New()
+	notFound := http.NotFoundHandler()
+	var errs configErrors
+	if fallback != nil {
+		if err := fallback.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("default response: %v", err))
+		}
+		notFound = fallbackHandler(fallback)
+	}
+	notFound, err := proxyHandler(proxies, notFound)
+	if err != nil {
+		errs = errs.add(err)
+	}
+	if len(proxies) > 0 {
+		// forward requests of other methods instead of 405
+		router.HandleMethodNotAllowed = false
+	}
+	router.NotFound = notFound
+	groups := map[string][]*HttpRoute{}
+	var keys []string // in declared order
+	for _, r := range routes {
+		slog.Infof("add mock HTTP API: %s %s", r.Method, r.Uri)
+		if !supportedMethod(r.Method) {
+			slog.Warnf("Unsupported method %s", r.Method)
+			continue
+		}
+		if err := r.compile(); err != nil {
+			errs = append(errs, newConfigError(r.file, r.line, "%v", err))
+			continue
+		}
+		if r.Scenario != nil {
+			scenarios.add(r.Scenario.Name)
+		}
+		key := r.Method + " " + r.Uri
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], r)
+	}
+	for _, key := range keys {
+		if err := handleRoutes(router, groups[key], notFound, scenarios); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	return router, nil
+}
+
+func supportedMethod(method string) bool {
+	switch method {
+	case "GET", "POST", "HEAD", "DELETE", "PUT", "PATCH", "OPTIONS":
+		return true
+	}
+
+	return false
+}
+
+// handleRoutes adds routes of same method and uri to router, route conflict is
+// returned as error. A route matches if its request matchers match and its
+// scenario is in the required state.
+func handleRoutes(router *httprouter.Router, routes []*HttpRoute, fallback http.Handler, scenarios *scenarioStates) (err error) {
+	r := routes[0]
+	defer func() {
+		// httprouter panics on conflicted paths
+		if p := recover(); p != nil {
+			err = newConfigError(r.file, r.line, "%v", p)
+		}
+	}()
+	handlers := make([]httprouter.Handle, len(routes))
+	for idx, route := range routes {
+		handlers[idx] = uriHandler(route)
+	}
+	router.Handle(r.Method, r.Uri, func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		for idx, route := range routes {
+			if route.Request.Match(req) && scenarios.enter(route.Scenario) {
+				handlers[idx](w, req, ps)
+				return
+			}
+		}
+		fallback.ServeHTTP(w, req)
+	})
+
+	return nil
+}
+
+// fallbackHandler serves response if no route matches
+func fallbackHandler(response *HttpResponse) http.Handler {
+	handle := uriHandler(&HttpRoute{Response: response})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handle(w, r, nil)
+	})
+}
+
+// updateRoutes applies fn to a copy of current routes, and swaps in the new
+// routes only if new router is built successfully. Routes, hosts and default
+// response are copied before compiling, as the current ones may be serving.
+func (s *HttpServer) updateRoutes(fn func([]*HttpRoute) ([]*HttpRoute, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	routes, err := fn(cloneRoutes(s.Routes))
+	if err != nil {
+		return err
+	}
+	if s.scenarios == nil {
+		s.scenarios = newScenarioStates(s.Scenarios)
+	}
+	hosts, fallback := cloneHosts(s.Hosts), s.Default.clone()
+	t, err := newHTTPTable(hosts, routes, fallback, s.Proxy, s.scenarios)
+	if err != nil {
+		return err
+	}
+	s.Routes, s.Hosts, s.Default = routes, hosts, fallback
+	s.router.Store(t)
+
+	return nil
+}
+
+func (s *HttpServer) ListRoutes() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*HttpRoute{}, s.Routes...)
+}
+
+// ResetSequences resets sequence counters of client key, or all counters if
+// key is empty
+func (s *HttpServer) ResetSequences(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.allRoutes() {
+		if r.Sequence != nil {
+			r.Sequence.reset(key)
+		}
+	}
+}
+
+// ListScenarios returns {name: current state} of scenarios
+func (s *HttpServer) ListScenarios() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scenarios == nil {
+		return map[string]string{}
+	}
+	return s.scenarios.list()
+}
+
+// SetScenario moves scenario name to state
+func (s *HttpServer) SetScenario(name string, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scenarios == nil {
+		return fmt.Errorf("scenario %s does not exist", name)
+	}
+	return s.scenarios.set(name, state)
+}
+
+// ResetScenarios resets scenario name to initial state, or all scenarios if
+// name is empty
+func (s *HttpServer) ResetScenarios(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scenarios == nil {
+		return nil
+	}
+	return s.scenarios.reset(name)
+}
+
+func (s *HttpServer) ListHosts() []*HttpHost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*HttpHost{}, s.Hosts...)
+}
+
+func (s *HttpServer) AddRoute(data []byte) error {
+	route, err := parseHTTPRoute(data)
+	if err != nil {
+		return err
+	}
+
+	return s.updateRoutes(func(routes []*HttpRoute) ([]*HttpRoute, error) {
+		return append(routes, route), nil
+	})
+}
+
+func (s *HttpServer) UpdateRoute(idx int, data []byte) error {
+	route, err := parseHTTPRoute(data)
+	if err != nil {
+		return err
+	}
+
+	return s.updateRoutes(func(routes []*HttpRoute) ([]*HttpRoute, error) {
+		if idx < 0 || idx >= len(routes) {
+			return nil, fmt.Errorf("route %d does not exist", idx)
+		}
+		routes[idx] = route
+		return routes, nil
+	})
+}
+
+func (s *HttpServer) DeleteRoute(idx int) error {
+	return s.updateRoutes(func(routes []*HttpRoute) ([]*HttpRoute, error) {
+		if idx < 0 || idx >= len(routes) {
+			return nil, fmt.Errorf("route %d does not exist", idx)
+		}
+		return append(routes[:idx], routes[idx+1:]...), nil
+	})
+}
+
+func (s *HttpServer) SetRoutes(data []byte) error {
+	var routes []*HttpRoute
+	if err := yaml.Unmarshal(data, &routes); err != nil {
+		return err
+	}
+	if err := nullItems(data, ""); err != nil {
+		return err
+	}
+	for _, r := range routes {
+		r.normalize()
+	}
+
+	return s.updateRoutes(func([]*HttpRoute) ([]*HttpRoute, error) {
+		return routes, nil
+	})
+}
+
+// ResetRoutes reloads routes from cfg file, or cfg data if not loaded from file
+func (s *HttpServer) ResetRoutes() error {
+	c, err := s.reload()
+	if err != nil {
+		return err
+	}
+
+	return s.reset(c)
+}
+
+// prepareReset loads and checks a new copy of config, and returns func which
+// swaps it in, so that servers are reset together only if all configs are valid
+func (s *HttpServer) prepareReset() (func() error, error) {
+	c, err := s.reload()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := newHTTPTable(c.Hosts, c.Routes, c.Default, c.Proxy, newScenarioStates(c.Scenarios)); err != nil {
+		return nil, err
+	}
+	if _, err := c.loadCertificates(); err != nil {
+		return nil, err
+	}
+
+	return func() error { return s.reset(c) }, nil
+}
+
+// reset applies reloaded config c, and watches its files
+func (s *HttpServer) reset(c *HttpServer) error {
+	if err := s.apply(c); err != nil {
+		return err
+	}
+	if s.w != nil {
+		return s.w.Include(c.watchedFiles()...)
+	}
+
+	return nil
+}
+
+// apply swaps in routes, certificate and port of c. The new port is bound
+// before anything changes, and the old listener is stopped gracefully.
+func (s *HttpServer) apply(c *HttpServer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scenarios := newScenarioStates(c.Scenarios)
+	t, err := newHTTPTable(c.Hosts, c.Routes, c.Default, c.Proxy, scenarios)
+	if err != nil {
+		return err
+	}
+	certs, err := c.loadCertificates()
+	if err != nil {
+		return err
+	}
+	if s.listener != nil && c.Port != s.Port {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", c.Port))
+		if err != nil {
+			return err
+		}
+		old, cancelStreams := s.server, s.cancel
+		s.server, s.cancel = s.newServer(c.Port)
+		s.listener = l
+		s.serve(s.server, l)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			slog.Infof("port changed, shutting down server on %s", old.Addr)
+			cancelStreams() // end streams held open on old port
+			old.Shutdown(ctx)
+		}()
+	}
+	if s.listener == nil && s.server != nil {
+		s.server.Addr = fmt.Sprintf(":%d", c.Port)
+	}
+
+	s.Routes, s.Default, s.Hosts, s.Proxy = c.Routes, c.Default, c.Hosts, c.Proxy
+	s.Scenarios, s.scenarios = c.Scenarios, scenarios
+	s.router.Store(t)
+	s.cert.Store(certs)
+	s.Port, s.CertFile, s.KeyFile, s.Include = c.Port, c.CertFile, c.KeyFile, c.Include
+
+	return nil
+}
+
+// reload loads a new copy of config
+func (s *HttpServer) reload() (*HttpServer, error) {
+	c := &HttpServer{}
+	switch {
+	case s.cfgFile != "":
+		if err := c.loadConfig(s.cfgFile); err != nil {
+			return nil, err
+		}
+	case s.cfgData != nil:
+		if err := c.Load(s.cfgData); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("server is not loaded from config")
+	}
+
+	return c, nil
+}
+
+// parseHTTPRoute parses a route from YAML or JSON data
+func parseHTTPRoute(data []byte) (*HttpRoute, error) {
+	var route HttpRoute
+	if err := yaml.Unmarshal(data, &route); err != nil {
+		return nil, err
+	}
+	if route.Uri == "" {
+		return nil, errors.New("uri is not set")
+	}
+	route.normalize()
+
+	return &route, nil
+}
+
+func uriHandler(route *HttpRoute) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		params, err := getRequestParams(r, ps)
+		if err != nil {
+			// NOTE: no return but log error
+			slog.Errorf("read request params error: %v", err)
+			w.Header().Set("Moko-Error", err.Error())
+		}
+		if route.Static != "" {
+			route.serveStatic(w, r, ps)
+			return
+		}
+		if route.Websocket != nil || route.Passthrough != nil {
+			if e := journalEntryFromContext(r.Context()); e != nil {
+				e.Route = route.Method + " " + route.Uri
+				e.Params = journalParams(params)
+			}
+			if route.Websocket != nil {
+				route.Websocket.serve(w, r, params)
+			} else {
+				route.Passthrough.serve(w, r, params)
+			}
+			return
+		}
+		response := route.Response
+		variant := -1
+		switch {
+		case route.Sequence != nil:
+			variant = route.Sequence.next(route.Sequence.clientKey(r))
+			response = route.Sequence.Responses[variant]
+			slog.Debugf("%s %s: serve sequence response %d", route.Method, route.Uri, variant)
+		case len(route.Oneof) > 0:
+			variant = route.pick()
+			response = route.Oneof[variant]
+			slog.Debugf("%s %s: serve oneof response %d", route.Method, route.Uri, variant)
+		}
+		if e := journalEntryFromContext(r.Context()); e != nil {
+			if route.Uri != "" {
+				e.Route = route.Method + " " + route.Uri
+			}
+			e.Params = journalParams(params)
+			if variant >= 0 {
+				e.Variant = &variant
+			}
+		}
+
+		// write response headers
+		if response.Stream != nil {
+			response.Stream.setHeaders(w.Header())
+		}
+		for _, h := range response.compiled.headers {
+			rk, err := h.key.render(params)
+			if err != nil {
+				slog.Errorf("render header key %s error: %v", h.key.text, err)
+				continue
+			}
+			rv, err := h.value.render(params)
+			if err != nil {
+				slog.Errorf("render header value %s error: %v", h.value.text, err)
+				continue
+			}
+			w.Header().Set(rk, rv)
+		}
+		if response.compiled.json {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		raw, err := response.rawBody(params)
+		if err != nil {
+			slog.Errorf("read response body error: %v", err)
+			w.Header().Set("Moko-Error", err.Error())
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				w.WriteHeader(http.StatusNotFound)
+			case errors.Is(err, errPathOutside), errors.Is(err, os.ErrPermission):
+				w.WriteHeader(http.StatusForbidden)
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		if raw != nil && w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", response.contentType(raw))
+		}
+
+		// handle delay
+		if response.Delay > 0 {
+			time.Sleep(time.Duration(response.Delay) * time.Millisecond)
+		}
+
+		// write status code
+		w.WriteHeader(response.Code)
+		if response.Stream != nil {
+			response.Stream.serve(r.Context(), w, params)
+			return
+		}
+		if raw != nil {
+			w.Write(raw)
+			return
+		}
+		// render template
+		var renderedBody string
+		if response.compiled.object != nil {
+			if renderedBody, err = response.compiled.object.marshal(params); err == nil {
+				renderedBody = response.indentJSON(renderedBody)
+			}
+		} else {
+			renderedBody, err = response.compiled.body.render(params)
+		}
+		if err != nil {
+			slog.Errorf("render response template error: %v", err)
+			fmt.Fprint(w, response.compiled.body.text)
+			return
+		}
+		fmt.Fprint(w, renderedBody)
+	}
+}
+
+// getRequestParams returns flat params of path, query, form and top-level JSON
+// keys, and the structured request context under "request"
+func getRequestParams(r *http.Request, ps httprouter.Params) (map[string]interface{}, error) {
+	// restore body for later readers, eg. passthrough
+	body := readBody(r)
+	defer func() { r.Body = io.NopCloser(bytes.NewReader(body)) }()
+
+	params, err := getFlatParams(r, ps)
+	params["request"] = requestContext(r, ps, body)
+
+	return params, err
+}
+
+func getFlatParams(r *http.Request, ps httprouter.Params) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	// render path variable
+	for _, p := range ps {
+		params[p.Key] = p.Value
+	}
+	// parse URL query and form-data
+	if err := r.ParseForm(); err != nil {
+		return params, err
+	}
+	for qk := range r.Form {
+		params[qk] = r.Form.Get(qk)
+	}
+	// parse json data
+	if r.Header.Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			return params, err
+		}
+	}
+
+	return params, nil
+}
+
+// requestContext returns structured request for templates, eg.
+// ${request.headers.X-Trace-Id} or ${request.query.page}
+func requestContext(r *http.Request, ps httprouter.Params, body []byte) map[string]interface{} {
+	u := *r.URL
+	if !u.IsAbs() {
+		u.Scheme, u.Host = "http", r.Host
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+	headers := map[string]interface{}{}
+	for k, v := range r.Header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	cookies := map[string]interface{}{}
+	for _, c := range r.Cookies() {
+		cookies[c.Name] = c.Value
+	}
+	query := map[string]interface{}{}
+	for k := range r.URL.Query() {
+		query[k] = r.URL.Query().Get(k)
+	}
+	form := map[string]interface{}{}
+	for k := range r.PostForm {
+		form[k] = r.PostForm.Get(k)
+	}
+	path := map[string]interface{}{}
+	for _, p := range ps {
+		path[p.Key] = p.Value
+	}
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		data = nil
+	}
+
+	return map[string]interface{}{
+		"method":  r.Method,
+		"url":     u.String(),
+		"uri":     r.URL.RequestURI(),
+		"host":    r.Host,
+		"remote":  r.RemoteAddr,
+		"headers": headers,
+		"cookies": cookies,
+		"query":   query,
+		"form":    form,
+		"path":    path,
+		"body":    string(body),
+		"json":    data, // decoded JSON body, nil if not JSON
+	}
+}
+
+// journalParams returns params without the request context, which is
+// recorded in journal entry already
+func journalParams(params map[string]interface{}) map[string]interface{} {
+	flat := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		if k != "request" {
+			flat[k] = v
+		}
+	}
+
+	return flat
+}
+
+var tplPattern = regexp.MustCompile(`\$\{([^${}]+)\}`) // match ${}
+
+var tplKeyPath = regexp.MustCompile(`^[\w-]+(\.[\w-]+)+$`) // eg. request.headers.X-Trace-Id
+
+// tplAction converts ${var} to {{.var}}, and key paths which may not be valid
+// field names (eg. header names) to {{index . "request" "headers" "X-Trace-Id"}}.
+// Function calls and expressions starting with dot are kept as is, eg.
+// ${upper .name} to {{upper .name}}. A bare name is a param, and a function
+// without arguments is called only if no such param is set, so ${date} is
+// param date and ${uuid} is generated unless param uuid is set.
+func tplAction(match string) string {
+	expr := strings.TrimSpace(tplPattern.FindStringSubmatch(match)[1])
+	name := strings.FieldsFunc(expr, func(r rune) bool { return r == ' ' || r == '|' || r == '(' })
+	if len(name) > 0 && name[0] == expr && isGenerator(expr) {
+		return `{{paramOr $ "` + expr + `"}}`
+	}
+	if strings.HasPrefix(expr, ".") || (len(name) > 0 && tplFuncs[name[0]] != nil && name[0] != expr) {
+		return "{{" + expr + "}}"
+	}
+	if !tplKeyPath.MatchString(expr) || !strings.Contains(expr, "-") {
+		return "{{." + expr + "}}"
+	}
+
+	return `{{index . "` + strings.Join(strings.Split(expr, "."), `" "`) + `"}}`
+}
+
+// escapeTemplate escapes {{ and ${ in s, so that s is rendered as is
+func escapeTemplate(s string) string {
+	s = strings.ReplaceAll(s, "{{", `{{"{{"}}`)
+
+	return strings.ReplaceAll(s, "${", `{{"$"}}{`)
+}
+
+// parseTemplate parses text with template functions
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("response").Funcs(tplFuncs).Funcs(template.FuncMap{"paramOr": paramOr}).Parse(text)
+}
+
+// textTemplate is text parsed as template once, and rendered per request
+type textTemplate struct {
+	text string
+	tpl  *template.Template // nil if text has no actions
+}
+
+func newTextTemplate(text string) (*textTemplate, error) {
+	t := &textTemplate{text: text}
+	if !strings.ContainsRune(text, '{') || !strings.ContainsRune(text, '}') {
+		return t, nil
+	}
+	// replace ${var} => {{.var}}
+	tpl, err := parseTemplate(tplPattern.ReplaceAllStringFunc(text, tplAction))
+	if err != nil {
+		return nil, err
+	}
+	if nodes := tpl.Tree.Root.Nodes; len(nodes) != 1 || nodes[0].Type() != parse.NodeText || nodes[0].String() != text {
+		t.tpl = tpl
+	}
+
+	return t, nil
+}
+
+// render executes template with params, nil template renders empty string
+func (t *textTemplate) render(params map[string]interface{}) (string, error) {
+	switch {
+	case t == nil:
+		return "", nil
+	case t.tpl == nil:
+		return t.text, nil
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := t.tpl.Execute(buf, params); err != nil {
+		return t.text, err
+	}
+
+	return buf.String(), nil
+}
+
+// renderString parses and renders body, prefer textTemplate for text rendered
+// repeatedly
+func renderString(body string, params map[string]interface{}) (string, error) {
+	t, err := newTextTemplate(body)
+	if err != nil {
+		return body, err
+	}
+
+	return t.render(params)
+}
+
+// dataTemplate is compiled data of stream event or WebSocket message, string
+// is rendered as text, and structure as JSON
+type dataTemplate struct {
+	text   *textTemplate // text, or JSON of structure
+	object *jsonTemplate // templated structure
+}
+
+func newDataTemplate(data interface{}) (*dataTemplate, error) {
+	switch d := data.(type) {
+	case nil:
+		return &dataTemplate{}, nil
+	case string:
+		text, err := newTextTemplate(d)
+		if err != nil {
+			return nil, err
+		}
+		return &dataTemplate{text: text}, nil
+	}
+	jsonBytes, err := MarshalJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	t := &dataTemplate{text: &textTemplate{text: string(jsonBytes)}}
+	object, err := newJSONTemplate(data)
+	if err != nil {
+		return nil, err
+	}
+	if object.kind != jsonStatic {
+		t.object = object
+	}
+
+	return t, nil
+}
+
+// render renders data with params, the unrendered data is returned with error
+func (t *dataTemplate) render(params map[string]interface{}) (string, error) {
+	if t.object == nil {
+		return t.text.render(params)
+	}
+	rendered, err := t.object.marshal(params)
+	if err != nil {
+		return t.text.text, err
+	}
+
+	return rendered, nil
+}
+
+// ServeHTTP serves request with the active router, in-flight requests finish
+// on the router they started with
+func (s *HttpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t, _ := s.router.Load().(*httpTable)
+	if t == nil {
+		http.NotFound(w, r)
+		return
+	}
+	t.ServeHTTP(w, r)
+}
+
+// Serve serves on configured port until Shutdown
+func (s *HttpServer) Serve(wg *sync.WaitGroup) error {
+	defer wg.Done()
+
+	if _, err := s.Start(""); err != nil {
+		return err
+	}
+	<-s.done
+
+	return nil
+}
+
+// Start serves in background on addr, or on configured port if addr is empty.
+// Use port 0 in addr (eg. "127.0.0.1:0") to listen on an ephemeral port.
+func (s *HttpServer) Start(addr string) (net.Addr, error) {
+	if s.server == nil {
+		if err := s.setup(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if addr == "" {
+		addr = s.server.Addr
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.listener = l
+	s.serve(s.server, l)
+
+	return l.Addr(), nil
+}
+
+// serve serves on l in background, connections are served with TLS if
+// certificate is configured at the time they are accepted
+func (s *HttpServer) serve(server *http.Server, l net.Listener) {
+	if s.certificates().enabled() {
+		slog.Infof("with cert and key file configured, start HTTPS server on %s", l.Addr())
+	} else {
+		slog.Infof("start HTTP server on %s", l.Addr())
+	}
+	tlsConfig := &tls.Config{GetCertificate: s.getCertificate, NextProtos: []string{"h2", "http/1.1"}}
+	go func() {
+		err := server.Serve(&tlsSwitchListener{Listener: l, s: s, config: tlsConfig})
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Errorf("serve on %s error: %v", l.Addr(), err)
+		}
+	}()
+}
+
+// tlsSwitchListener wraps accepted connections with TLS if certificate is
+// configured, so that HTTPS can be switched on or off without restarting
+type tlsSwitchListener struct {
+	net.Listener
+	s      *HttpServer
+	config *tls.Config
+}
+
+func (l *tlsSwitchListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.s.certificates().enabled() {
+		return tls.Server(conn, l.config), nil
+	}
+
+	return conn, nil
+}
+
+// URL returns base URL of server started by Start
+func (s *HttpServer) URL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return ""
+	}
+	if s.certificates().enabled() {
+		return "https://" + s.listener.Addr().String()
+	}
+
+	return "http://" + s.listener.Addr().String()
+}
+
+func (s *HttpServer) Shutdown() error {
+	if s.w != nil {
+		s.w.Stop()
+	}
+	s.mu.Lock()
+	server, cancelStreams, done := s.server, s.cancel, s.done
+	s.mu.Unlock()
+	if server == nil { // not started
+		return nil
+	}
+	slog.Infof("shutting down server on %s", server.Addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if cancelStreams != nil {
+		cancelStreams() // end streams held open
+	}
+	err := server.Shutdown(ctx)
+	if s.Record != nil {
+		if err := s.Record.Save(); err != nil {
+			slog.Errorf("save recorded routes error: %v", err)
+		}
+	}
+	if done != nil {
+		s.stopOnce.Do(func() { close(done) })
+	}
+
+	return err
+}
+
+func init() {
+	ServerMap.Add("http", func() Server { return NewHttpServer() })
+}
@@ -0,0 +1,656 @@
+package mock
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func getUris(routes []*HttpRoute) []string {
+	uris := make([]string, len(routes))
+	for idx, r := range routes {
+		uris[idx] = strings.Join([]string{r.Method, r.Uri}, " ")
+	}
+
+	return uris
+}
+
+func TestHTTPServer(t *testing.T) {
+	s := NewHttpServer()
+	s.Init("../examples/http-mock.yml")
+
+	doHTTPRequest := func(method string, uri string, data io.Reader, headers map[string]string) *http.Response {
+		req, _ := http.NewRequest(method, uri, data)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+
+		return w.Result()
+	}
+
+	Convey("parse cfg file", t, func() {
+		So(s.Port, ShouldEqual, defaultHTTPPort)
+		uris := getUris(s.Routes)
+		So(uris, ShouldContain, "GET /hello")
+		So(uris, ShouldContain, "POST /hello")
+		So(uris, ShouldContain, "GET /hello/:name")
+		So(uris, ShouldContain, "POST /hello/form/:name")
+		So(uris, ShouldContain, "POST /hello/json/:name")
+	})
+
+	Convey("mock GET static uri", t, func() {
+		resp := doHTTPRequest("GET", "/hello", nil, nil)
+		So(resp.StatusCode, ShouldEqual, 201)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "text/plain")
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "hello world")
+	})
+
+	Convey("mock POST static uri", t, func() {
+		resp := doHTTPRequest("POST", "/hello", nil, nil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "application/json")
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "{\"hello\":\"world\",\"another\":{\"sub\":\"subvalue\"}}")
+	})
+
+	Convey("mock GET dynamic uri", t, func() {
+		resp := doHTTPRequest("GET", "/hello/world", nil, nil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(resp.Header.Get("trace-id"), ShouldEqual, "12345")
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "hello world")
+	})
+
+	Convey("mock GET dynamic uri matched by header", t, func() {
+		resp := doHTTPRequest("GET", "/hello/world", nil, map[string]string{"X-Lang": "fr"})
+		So(resp.StatusCode, ShouldEqual, 200)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "bonjour world")
+	})
+
+	Convey("mock GET dynamic uri with parameters", t, func() {
+		resp := doHTTPRequest("GET", "/user/20?name=world", nil, nil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "user world 20")
+	})
+
+	Convey("mock POST form-data dynamic uri", t, func() {
+		resp := doHTTPRequest("POST", "/hello/form/world", strings.NewReader("age=20"), map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+		So(resp.StatusCode, ShouldEqual, 200)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "{\"name\":\"world\",\"age\":\"20\"}")
+	})
+
+	Convey("mock POST json dynamic uri", t, func() {
+		resp := doHTTPRequest("POST", "/hello/json/world", strings.NewReader("{\"age\":20,\"location\":{\"city\":\"hangzhou\"}}"), map[string]string{"Content-Type": "application/json"})
+		So(resp.StatusCode, ShouldEqual, 200)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "{\"name\":\"world\",\"age\":20,\"location\":{\"city\":\"hangzhou\"}}")
+	})
+
+	Convey("mock get delay response", t, func() {
+		start := time.Now()
+		resp := doHTTPRequest("GET", "/delay", nil, nil)
+		duration := time.Since(start)
+		So(duration.Milliseconds(), ShouldBeGreaterThanOrEqualTo, 1)
+		So(resp.StatusCode, ShouldEqual, 200)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "{\"success\":true}")
+	})
+
+	Convey("mock return dynamic headers", t, func() {
+		resp := doHTTPRequest("GET", "/header/abc", nil, nil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(resp.Header.Get("user-name"), ShouldEqual, "abc")
+	})
+}
+
+func TestHTTPSServer(t *testing.T) {
+	s := NewHttpServer()
+	s.Init("../examples/https-mock.yml")
+
+	Convey("parse cfg file", t, func() {
+		So(s.Port, ShouldEqual, defaultHTTPPort)
+		uris := getUris(s.Routes)
+		So(uris, ShouldContain, "GET /hello")
+		So(uris, ShouldContain, "POST /hello")
+		So(uris, ShouldContain, "GET /hello/:name")
+	})
+
+	Convey("mock GET static uri", t, func() {
+		req, _ := http.NewRequest("GET", "/hello", nil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		resp := w.Result()
+		So(resp.StatusCode, ShouldEqual, 201)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "text/plain")
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "hello world")
+	})
+}
+
+func TestRenderString(t *testing.T) {
+	params := map[string]interface{}{
+		"name": "world",
+	}
+
+	Convey("no tpl usage", t, func() {
+		data, err := renderString("hello world", params)
+		So(err, ShouldBeNil)
+		So(data, ShouldEqual, "hello world")
+		data, err = renderString(`{"name": "hello world"}`, params)
+		So(err, ShouldBeNil)
+		So(data, ShouldEqual, `{"name": "hello world"}`)
+	})
+
+	Convey("go tpl usage", t, func() {
+		data, err := renderString("hello {{.name}}", params)
+		So(err, ShouldBeNil)
+		So(data, ShouldEqual, "hello world")
+		data, err = renderString(`{"name": "hello {{.name}}"}`, params)
+		So(err, ShouldBeNil)
+		So(data, ShouldEqual, `{"name": "hello world"}`)
+	})
+
+	Convey("shell tpl usage", t, func() {
+		data, err := renderString("hello ${name}", params)
+		So(err, ShouldBeNil)
+		So(data, ShouldEqual, "hello world")
+		data, err = renderString(`{"name": "hello ${name}"}`, params)
+		So(err, ShouldBeNil)
+		So(data, ShouldEqual, `{"name": "hello world"}`)
+	})
+}
+
+func TestTextTemplate(t *testing.T) {
+	Convey("keep text without actions", t, func() {
+		for _, text := range []string{"hello", `{"name": "world"}`, "{ }"} {
+			tpl, err := newTextTemplate(text)
+			So(err, ShouldBeNil)
+			So(tpl.tpl, ShouldBeNil)
+		}
+		tpl, err := newTextTemplate("{{/* note */}}hello")
+		So(err, ShouldBeNil)
+		So(tpl.tpl, ShouldNotBeNil)
+		data, err := tpl.render(nil)
+		So(err, ShouldBeNil)
+		So(data, ShouldEqual, "hello")
+	})
+
+	Convey("render compiled template repeatedly", t, func() {
+		tpl, err := newTextTemplate("hello ${name}")
+		So(err, ShouldBeNil)
+		for _, name := range []string{"a", "b"} {
+			data, err := tpl.render(map[string]interface{}{"name": name})
+			So(err, ShouldBeNil)
+			So(data, ShouldEqual, "hello "+name)
+		}
+	})
+
+	Convey("report template syntax errors at load time", t, func() {
+		for _, cfg := range []string{
+			"routes:\n  - uri: /a\n    response: {body: 'hello {{.name}'}\n",
+			"routes:\n  - uri: /a\n    response: {body: {name: '{{if .a}}'}}\n",
+			"routes:\n  - uri: /a\n    response: {headers: {X-Name: '{{upper .a}'}}\n",
+			"routes:\n  - uri: /a\n    oneof: [{body: '{{end}}'}]\n",
+			"default: {body: '{{.a}'}\n",
+			"routes:\n  - uri: /a\n    response: {bodyFile: 'fx/{{.a}'}\n",
+			"routes:\n  - uri: /a\n    response: {stream: {events: [{data: '{{.a}'}]}}\n",
+			"routes:\n  - uri: /a\n    response: {stream: {events: [{data: {a: '{{.a}'}}]}}\n",
+			"routes:\n  - uri: /a\n    response: {stream: {chunks: [{data: '{{.a}'}]}}\n",
+			"routes:\n  - uri: /a\n    websocket: {onConnect: [{data: '{{.a}'}]}\n",
+			"routes:\n  - uri: /a\n    websocket: {replies: [{send: [{data: {a: '{{.a}'}}]}]}\n",
+			"routes:\n  - uri: /a\n    websocket: {push: [{interval: 1, data: '{{.a}'}]}\n",
+			"routes:\n  - uri: /a\n    passthrough: {upstream: 'http://127.0.0.1:1', responseHeaders: {X-A: '{{.a}'}}\n",
+			"routes:\n  - uri: /a\n    passthrough: {upstream: 'http://127.0.0.1:1', mergePatch: {a: '{{.a}'}}\n",
+			"routes:\n  - uri: /a\n    passthrough: {upstream: 'http://127.0.0.1:1', jsonPatch: [{op: add, path: /a, value: '{{.a}'}]}\n",
+			"routes:\n  - uri: /a\n    passthrough: {upstream: 'http://127.0.0.1:1', replace: [{regex: a, with: '{{.a}'}]}\n",
+		} {
+			s := NewHttpServer()
+			So(s.Load([]byte(cfg)), ShouldBeNil)
+			So(s.initRoutes(), ShouldNotBeNil)
+		}
+	})
+}
+
+func TestJSONBodyFormat(t *testing.T) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+routes:
+  - uri: /orders/:id
+    response:
+      body:
+        id: ${id}
+        total: 12345678901234567890.10
+        2: two
+        items: [{sku: b, qty: 1}]
+  - uri: /pretty
+    response:
+      indent: 2
+      body:
+        b: ${name}
+        a: [1]
+  - uri: /pretty/static
+    response:
+      indent: 4
+      body: {b: 1, a: 2}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	do := func(uri string) string {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", uri, nil))
+		return w.Body.String()
+	}
+
+	Convey("write keys in YAML order and numbers as written", t, func() {
+		So(do("/orders/7"), ShouldEqual, `{"id":"7","total":12345678901234567890.10,"2":"two","items":[{"sku":"b","qty":1}]}`)
+	})
+
+	Convey("indent structured body", t, func() {
+		So(do("/pretty?name=x"), ShouldEqual, "{\n  \"b\": \"x\",\n  \"a\": [\n    1\n  ]\n}")
+		So(do("/pretty/static"), ShouldEqual, "{\n    \"b\": 1,\n    \"a\": 2\n}")
+	})
+
+	Convey("check indent", t, func() {
+		for _, cfg := range []string{
+			"routes:\n  - uri: /a\n    response: {indent: 2, body: text}\n",
+			"routes:\n  - uri: /a\n    response: {indent: -1, body: [1]}\n",
+		} {
+			s := NewHttpServer()
+			So(s.Load([]byte(cfg)), ShouldBeNil)
+			So(s.initRoutes(), ShouldNotBeNil)
+		}
+	})
+}
+
+func BenchmarkRenderString(b *testing.B) {
+	body := `{"id": "${id}", "name": "{{.name}}", "items": [1, 2, 3]}`
+	params := map[string]interface{}{"id": "1", "name": "world"}
+
+	b.Run("parse", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			renderString(body, params)
+		}
+	})
+	b.Run("compiled", func(b *testing.B) {
+		tpl, _ := newTextTemplate(body)
+		for i := 0; i < b.N; i++ {
+			tpl.render(params)
+		}
+	})
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+routes:
+  - uri: /users/:id
+    response:
+      headers:
+        X-User-Id: ${id}
+        Cache-Control: no-cache
+      body:
+        id: ${id}
+        name: world
+        tags: [a, b, c]
+  - uri: /static
+    response:
+      headers:
+        Cache-Control: no-cache
+      body:
+        name: world
+        tags: [a, b, c]
+`))
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, uri := range []string{"/users/1", "/static"} {
+		b.Run(uri, func(b *testing.B) {
+			req := httptest.NewRequest("GET", uri, nil)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				s.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+routes:
+  - uri: /users/:id
+    method: POST
+    response:
+      headers:
+        X-Trace-Id: ${request.headers.X-Trace-Id}
+      body: |-
+        ${request.method} ${request.url}
+        path=${request.path.id} query=${request.query.id} json=${request.json.id} flat=${id}
+        session=${request.cookies.session} remote=${request.remote}
+        body=${request.body}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("render structured request context", t, func() {
+		req := httptest.NewRequest("POST", "http://example.test/users/1?id=2", strings.NewReader(`{"id": 3}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Trace-Id", "abc")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		So(w.Header().Get("X-Trace-Id"), ShouldEqual, "abc")
+		So(w.Body.String(), ShouldEqual, strings.Join([]string{
+			"POST http://example.test/users/1?id=2",
+			"path=1 query=2 json=3 flat=3",
+			"session=s1 remote=192.0.2.1:1234",
+			`body={"id": 3}`,
+		}, "\n"))
+	})
+
+	Convey("keep request context out of journal params", t, func() {
+		j := NewJournal(10)
+		req := httptest.NewRequest("POST", "/users/1", nil)
+		journalHandler(j, s).ServeHTTP(httptest.NewRecorder(), req)
+		e := j.Find(&JournalFilter{})[0]
+		So(e.Params, ShouldResemble, map[string]interface{}{"id": "1"})
+	})
+}
+
+func TestStartHTTPServer(t *testing.T) {
+	Convey("start server from YAML data on ephemeral port", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /hello\n    response:\n      body: hello world\n")), ShouldBeNil)
+		addr, err := s.Start("127.0.0.1:0")
+		So(err, ShouldBeNil)
+		t.Cleanup(func() { s.Shutdown() })
+		So(s.URL(), ShouldEqual, "http://"+addr.String())
+
+		resp, err := http.Get(s.URL() + "/hello")
+		So(err, ShouldBeNil)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "hello world")
+
+		// reset to loaded data
+		So(s.SetRoutes([]byte("[]")), ShouldBeNil)
+		So(s.ResetRoutes(), ShouldBeNil)
+		So(len(s.Routes), ShouldEqual, 1)
+	})
+
+	Convey("start server from struct", t, func() {
+		s := &HttpServer{Routes: []*HttpRoute{{Uri: "/hello", Response: &HttpResponse{Code: 202}}}}
+		_, err := s.Start("127.0.0.1:0")
+		So(err, ShouldBeNil)
+		t.Cleanup(func() { s.Shutdown() })
+
+		resp, err := http.Get(s.URL() + "/hello")
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 202)
+	})
+
+	Convey("shut down server not started", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /hello\n")), ShouldBeNil)
+		So(s.Shutdown(), ShouldBeNil)
+		So((&HttpServer{}).Shutdown(), ShouldBeNil)
+	})
+}
+
+func TestHTTPServerRouteErrors(t *testing.T) {
+	Convey("report all route conflicts with line", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /hello/:name\n  - uri: /hello/world\n  - uri: /hello/:id\n")), ShouldBeNil)
+		_, err := newRouter(s.Routes, nil, nil, nil)
+		So(err, ShouldNotBeNil)
+		errs := err.(configErrors)
+		So(len(errs), ShouldEqual, 2)
+		So(errs[0].Error(), ShouldStartWith, "line 3: ")
+		So(errs[1].Error(), ShouldStartWith, "line 4: ")
+	})
+
+	Convey("reject null items with line", t, func() {
+		cases := map[string]string{
+			"routes:\n  - uri: /a\n  -\n":                        "line 3: empty item of routes",
+			"hosts:\n  - host: a.test\n    routes:\n      - ~\n": "line 4: empty item of routes",
+			"hosts:\n  - null\n":                                 "line 2: empty item of hosts",
+			"proxy:\n  - ~\n":                                    "line 2: empty item of proxy",
+		}
+		for cfg, msg := range cases {
+			s := NewHttpServer()
+			err := s.Load([]byte(cfg))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, msg)
+		}
+
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /a\n    sequence: {responses: [~]}\n  - uri: /b\n    oneof: [~]\n")), ShouldBeNil)
+		err := s.initRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "line 2: sequence response 0 is empty\nline 4: oneof response 0 is empty")
+		So(s.SetRoutes([]byte("[null]")), ShouldNotBeNil)
+		So((&HttpServer{Routes: []*HttpRoute{nil}}).validate(), ShouldNotBeNil)
+		So((&HttpServer{Hosts: []*HttpHost{{Host: "a.test", Routes: []*HttpRoute{nil}}}}).validate(), ShouldNotBeNil)
+	})
+}
+
+// freePort returns a port which is free to listen on
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestHTTPServerFullReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "http-mock.yml")
+	cert, _ := filepath.Abs("../examples/cert.pem")
+	key, _ := filepath.Abs("../examples/key.pem")
+	port := freePort(t)
+	os.WriteFile(file, []byte(fmt.Sprintf("port: %d\nroutes:\n  - uri: /hello\n", port)), 0644)
+	s := NewHttpServer()
+	if err := s.loadConfig(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+
+	Convey("keep old port if new port fails to bind", t, func() {
+		l, err := net.Listen("tcp", ":0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+		busy := l.Addr().(*net.TCPAddr).Port
+		os.WriteFile(file, []byte(fmt.Sprintf("port: %d\nroutes:\n  - uri: /busy\n", busy)), 0644)
+		So(s.ResetRoutes(), ShouldNotBeNil)
+		So(s.Port, ShouldEqual, port)
+		So(getUris(s.Routes), ShouldResemble, []string{"GET /hello"})
+		resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/hello", port))
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 200)
+	})
+
+	Convey("rebind on port change", t, func() {
+		newPort := freePort(t)
+		os.WriteFile(file, []byte(fmt.Sprintf("port: %d\nroutes:\n  - uri: /hello\n", newPort)), 0644)
+		So(s.ResetRoutes(), ShouldBeNil)
+		So(s.Port, ShouldEqual, newPort)
+		So(s.URL(), ShouldEndWith, fmt.Sprintf(":%d", newPort))
+		resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/hello", newPort))
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(func() error {
+			for i := 0; i < 50; i++ {
+				if _, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+					return err
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			return nil
+		}(), ShouldNotBeNil)
+		port = newPort
+	})
+
+	Convey("end open streams of old port on rebind", t, func() {
+		stream := "routes:\n  - uri: /open\n    response:\n      stream: {keepOpen: true, events: [{data: ready}]}\n"
+		os.WriteFile(file, []byte(fmt.Sprintf("port: %d\n%s", port, stream)), 0644)
+		So(s.ResetRoutes(), ShouldBeNil)
+		resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/open", port))
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		r := bufio.NewReader(resp.Body)
+		line, _ := r.ReadString('\n')
+		So(line, ShouldEqual, "data: ready\n")
+
+		newPort := freePort(t)
+		os.WriteFile(file, []byte(fmt.Sprintf("port: %d\n%s", newPort, stream)), 0644)
+		So(s.ResetRoutes(), ShouldBeNil)
+		ended := make(chan struct{})
+		go func() {
+			io.ReadAll(r)
+			close(ended)
+		}()
+		select {
+		case <-ended:
+		case <-time.After(2 * time.Second):
+			So("stream of old port is still open", ShouldBeEmpty)
+		}
+		port = newPort
+	})
+
+	Convey("switch to TLS with cert and key", t, func() {
+		os.WriteFile(file, []byte(fmt.Sprintf("port: %d\ncert: %s\nkey: %s\nroutes:\n  - uri: /hello\n", port, cert, key)), 0644)
+		So(s.ResetRoutes(), ShouldBeNil)
+		So(s.URL(), ShouldStartWith, "https://")
+		resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/hello", port))
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(resp.ProtoMajor, ShouldEqual, 2)
+	})
+
+	Convey("keep old certificate if new one is invalid", t, func() {
+		os.WriteFile(file, []byte(fmt.Sprintf("port: %d\ncert: %s\nkey: %s\nroutes:\n  - uri: /hello\n", port, cert, cert)), 0644)
+		So(s.ResetRoutes(), ShouldNotBeNil)
+		So(s.KeyFile, ShouldEqual, key)
+		resp, err := client.Get(fmt.Sprintf("https://127.0.0.1:%d/hello", port))
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, 200)
+	})
+}
+
+func TestOneofResponses(t *testing.T) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+routes:
+  - uri: /flaky
+    oneof:
+      - weight: 9
+        body: ok
+      - weight: 1
+        code: 503
+        body: unavailable
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	j := NewJournal(10)
+	handler := journalHandler(j, s)
+	codes := func(n int) []int {
+		codes := make([]int, n)
+		for idx := range codes {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/flaky", nil))
+			codes[idx] = w.Code
+		}
+		return codes
+	}
+
+	Convey("pick responses by weight", t, func() {
+		unavailable := 0
+		for _, code := range codes(1000) {
+			if code == 503 {
+				unavailable++
+			}
+		}
+		So(unavailable, ShouldBeBetween, 50, 150)
+	})
+
+	Convey("reproduce responses with same seed", t, func() {
+		SetSeed(42)
+		first := codes(50)
+		SetSeed(42)
+		So(codes(50), ShouldResemble, first)
+	})
+
+	Convey("record served variant in journal", t, func() {
+		for _, e := range j.Find(&JournalFilter{}) {
+			So(e.Variant, ShouldNotBeNil)
+			So(e.Response.Code, ShouldEqual, []int{200, 503}[*e.Variant])
+		}
+	})
+
+	Convey("report negative weight with line", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /flaky\n    oneof:\n      - weight: -1\n")), ShouldBeNil)
+		err := s.initRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "line 2: weight of oneof response 0 is negative")
+		So(s.Routes[0].Response, ShouldBeNil)
+	})
+
+	Convey("never pick response of weight 0", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /flaky\n    oneof:\n      - weight: 0\n        code: 503\n      - body: ok\n")), ShouldBeNil)
+		So(s.initRoutes(), ShouldBeNil)
+		for idx := 0; idx < 20; idx++ {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest("GET", "/flaky", nil))
+			So(w.Code, ShouldEqual, 200)
+		}
+
+		So(s.Load([]byte("routes:\n  - uri: /flaky\n    oneof:\n      - weight: 0\n")), ShouldBeNil)
+		err := s.initRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "line 2: total weight of oneof is 0")
+	})
+}
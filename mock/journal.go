@@ -0,0 +1,306 @@
+package mock
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gookit/slog"
+	"github.com/miekg/dns"
+)
+
+const DefaultJournalSize = 1000
+
+// JournalBodyLimit is the max size of recorded request and response bodies,
+// binary response bodies are not recorded
+const JournalBodyLimit = 64 << 10
+
+var RequestJournal = NewJournal(DefaultJournalSize) // global request journal
+
+// JournalEntry is a received HTTP request or DNS query
+type JournalEntry struct {
+	Time     time.Time              `yaml:"time"`
+	Protocol string                 `yaml:"protocol"`
+	Remote   string                 `yaml:"remote"`
+	Route    string                 `yaml:"route"` // matched route, empty if not matched
+	Method   string                 `yaml:"method,omitempty"`
+	Host     string                 `yaml:"host,omitempty"`
+	Path     string                 `yaml:"path,omitempty"`
+	Uri      string                 `yaml:"uri,omitempty"`
+	Headers  http.Header            `yaml:"headers,omitempty"`
+	Body     string                 `yaml:"body,omitempty"`
+	Encoding string                 `yaml:"encoding,omitempty"` // base64 if body is not UTF-8 text
+	Params   map[string]interface{} `yaml:"params,omitempty"`
+	Variant  *int                   `yaml:"variant,omitempty"` // index of served oneof or sequence response
+	Proxy    string                 `yaml:"proxy,omitempty"`   // upstream of forwarded request
+	Fqdn     string                 `yaml:"fqdn,omitempty"`
+	Qtype    string                 `yaml:"qtype,omitempty"`
+	Messages []*JournalMessage      `yaml:"messages,omitempty"` // WebSocket messages
+	Response *JournalResponse       `yaml:"response"`
+	Latency  float64                `yaml:"latency"` // in milliseconds
+}
+
+// JournalMessage is a WebSocket message, close message data is "code reason"
+type JournalMessage struct {
+	Time     time.Time `yaml:"time"`
+	From     string    `yaml:"from"` // client or server
+	Type     string    `yaml:"type"` // text, binary or close
+	Data     string    `yaml:"data"`
+	Encoding string    `yaml:"encoding,omitempty"` // base64 if data is not UTF-8 text
+}
+
+type JournalResponse struct {
+	Code     int         `yaml:"code,omitempty"`
+	Headers  http.Header `yaml:"headers,omitempty"`
+	Body     string      `yaml:"body,omitempty"`
+	Encoding string      `yaml:"encoding,omitempty"` // base64 if body is not UTF-8 text
+	Size     int         `yaml:"size,omitempty"`     // size of body written, larger than recorded body if truncated or binary
+	Rcode    string      `yaml:"rcode,omitempty"`    // DNS response code
+	Answers  []string    `yaml:"answers,omitempty"`  // DNS answers
+}
+
+// JournalFilter matches entries by non-empty fields
+type JournalFilter struct {
+	Protocol string
+	Method   string
+	Host     string
+	Path     string
+	Route    string
+	Fqdn     string
+	Qtype    string
+}
+
+func (f *JournalFilter) Match(e *JournalEntry) bool {
+	fqdn := f.Fqdn
+	if fqdn != "" && !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+
+	return (f.Protocol == "" || f.Protocol == e.Protocol) &&
+		(f.Method == "" || strings.EqualFold(f.Method, e.Method)) &&
+		(f.Host == "" || hostname(f.Host) == hostname(e.Host)) &&
+		(f.Path == "" || f.Path == e.Path) &&
+		(f.Route == "" || f.Route == e.Route || strings.HasSuffix(e.Route, " "+f.Route)) &&
+		(fqdn == "" || strings.EqualFold(fqdn, e.Fqdn)) &&
+		(f.Qtype == "" || strings.EqualFold(f.Qtype, e.Qtype))
+}
+
+// Journal keeps the latest received requests in a ring buffer
+type Journal struct {
+	mu      sync.Mutex
+	entries []*JournalEntry
+	next    int // next write position
+	full    bool
+}
+
+func NewJournal(size int) *Journal {
+	if size <= 0 {
+		size = DefaultJournalSize
+	}
+
+	return &Journal{entries: make([]*JournalEntry, size)}
+}
+
+func (j *Journal) Add(e *JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries[j.next] = e
+	j.next = (j.next + 1) % len(j.entries)
+	if j.next == 0 {
+		j.full = true
+	}
+}
+
+// Find returns matched entries, oldest first
+func (j *Journal) Find(f *JournalFilter) []*JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := j.entries[:j.next]
+	if j.full {
+		entries = append(append([]*JournalEntry{}, j.entries[j.next:]...), entries...)
+	}
+	result := []*JournalEntry{}
+	for _, e := range entries {
+		if f.Match(e) {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+func (j *Journal) Clear() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = make([]*JournalEntry, len(j.entries))
+	j.next = 0
+	j.full = false
+}
+
+type journalKey struct{}
+
+// journalEntryFromContext returns the entry of request being recorded, route
+// handlers fill in matched route and params
+func journalEntryFromContext(ctx context.Context) *JournalEntry {
+	e, _ := ctx.Value(journalKey{}).(*JournalEntry)
+	return e
+}
+
+// journalWriter records response status, headers and body up to
+// JournalBodyLimit, binary body is not recorded
+type journalWriter struct {
+	http.ResponseWriter
+	code   int
+	body   bytes.Buffer
+	size   int
+	binary bool
+}
+
+func (w *journalWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Flush flushes streaming response
+func (w *journalWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over connection for WebSocket
+func (w *journalWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijack")
+	}
+	if w.code == 0 {
+		w.code = http.StatusSwitchingProtocols
+	}
+
+	return h.Hijack()
+}
+
+func (w *journalWriter) Write(data []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if w.size == 0 {
+		contentType := w.Header().Get("Content-Type")
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		w.binary = !textContentType(contentType)
+	}
+	w.size += len(data)
+	if n := JournalBodyLimit - w.body.Len(); !w.binary && n > 0 {
+		if len(data) < n {
+			n = len(data)
+		}
+		w.body.Write(data[:n])
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// textContentType reports whether body of content type is text
+func textContentType(contentType string) bool {
+	t, _, _ := mime.ParseMediaType(contentType)
+	if strings.HasPrefix(t, "text/") {
+		return true
+	}
+	for _, s := range []string{"json", "xml", "javascript", "x-www-form-urlencoded", "yaml"} {
+		if strings.Contains(t, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// journalBody returns body truncated to JournalBodyLimit, and its encoding
+// "base64" if body is not UTF-8 text
+func journalBody(body []byte) (string, string) {
+	if len(body) > JournalBodyLimit {
+		body = body[:JournalBodyLimit]
+	}
+	if len(body) == JournalBodyLimit { // drop rune cut by limit
+		for idx := len(body) - 1; idx >= 0 && idx > len(body)-utf8.UTFMax; idx-- {
+			if utf8.RuneStart(body[idx]) {
+				if !utf8.FullRune(body[idx:]) {
+					body = body[:idx]
+				}
+				break
+			}
+		}
+	}
+
+	return encodeText(body)
+}
+
+// encodeText returns data as is if it is UTF-8 text, otherwise in base64 with
+// encoding "base64"
+func encodeText(data []byte) (string, string) {
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(data), "base64"
+}
+
+// journalHandler records HTTP requests served by next into j
+func journalHandler(j *Journal, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		var body []byte
+		if r.Body != nil {
+			var err error
+			if body, err = io.ReadAll(r.Body); err != nil {
+				slog.Errorf("read request body error: %v", err)
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		e := &JournalEntry{
+			Time:     start,
+			Protocol: "http",
+			Remote:   r.RemoteAddr,
+			Method:   r.Method,
+			Host:     r.Host,
+			Path:     r.URL.Path,
+			Uri:      r.RequestURI,
+			Headers:  r.Header.Clone(),
+		}
+		e.Body, e.Encoding = journalBody(body)
+		jw := &journalWriter{ResponseWriter: w}
+		next.ServeHTTP(jw, r.WithContext(context.WithValue(r.Context(), journalKey{}, e)))
+
+		e.Response = &JournalResponse{Code: jw.code, Headers: w.Header().Clone(), Size: jw.size}
+		e.Response.Body, e.Response.Encoding = journalBody(jw.body.Bytes())
+		e.Latency = float64(time.Since(start).Microseconds()) / 1000
+		j.Add(e)
+	})
+}
+
+func newDNSJournalResponse(m *dns.Msg) *JournalResponse {
+	resp := &JournalResponse{Rcode: dns.RcodeToString[m.Rcode], Answers: make([]string, len(m.Answer))}
+	for idx, rr := range m.Answer {
+		resp.Answers[idx] = rr.String()
+	}
+
+	return resp
+}
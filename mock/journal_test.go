@@ -0,0 +1,109 @@
+package mock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJournal(t *testing.T) {
+	Convey("keep latest entries", t, func() {
+		j := NewJournal(2)
+		So(len(j.Find(&JournalFilter{})), ShouldEqual, 0)
+		j.Add(&JournalEntry{Path: "/1"})
+		j.Add(&JournalEntry{Path: "/2"})
+		j.Add(&JournalEntry{Path: "/3"})
+		entries := j.Find(&JournalFilter{})
+		So(len(entries), ShouldEqual, 2)
+		So(entries[0].Path, ShouldEqual, "/2")
+		So(entries[1].Path, ShouldEqual, "/3")
+		j.Clear()
+		So(len(j.Find(&JournalFilter{})), ShouldEqual, 0)
+	})
+
+	Convey("filter entries", t, func() {
+		f := &JournalFilter{Method: "get", Route: "/hello/:name"}
+		So(f.Match(&JournalEntry{Method: "GET", Route: "GET /hello/:name"}), ShouldBeTrue)
+		So(f.Match(&JournalEntry{Method: "GET", Route: ""}), ShouldBeFalse)
+		f = &JournalFilter{Fqdn: "www.my.internal"}
+		So(f.Match(&JournalEntry{Fqdn: "www.my.internal."}), ShouldBeTrue)
+		So(f.Match(&JournalEntry{Fqdn: "host.my.internal."}), ShouldBeFalse)
+	})
+}
+
+func TestJournalHandler(t *testing.T) {
+	s := NewHttpServer()
+	s.Init("../examples/http-mock.yml")
+	j := NewJournal(10)
+	h := journalHandler(j, s)
+
+	doHTTPRequest := func(method string, uri string, data string, headers map[string]string) {
+		req, _ := http.NewRequest(method, uri, strings.NewReader(data))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	Convey("record matched request", t, func() {
+		doHTTPRequest("POST", "/hello/json/world", `{"age":20}`, map[string]string{"Content-Type": "application/json"})
+		entries := j.Find(&JournalFilter{Path: "/hello/json/world"})
+		So(len(entries), ShouldEqual, 1)
+		e := entries[0]
+		So(e.Route, ShouldEqual, "POST /hello/json/:name")
+		So(e.Body, ShouldEqual, `{"age":20}`)
+		So(e.Headers.Get("Content-Type"), ShouldEqual, "application/json")
+		So(e.Params["name"], ShouldEqual, "world")
+		So(e.Params["age"], ShouldEqual, 20)
+		So(e.Response.Code, ShouldEqual, 200)
+		So(e.Response.Headers.Get("Content-Type"), ShouldEqual, "application/json")
+		So(e.Response.Body, ShouldContainSubstring, `"name":"world"`)
+	})
+
+	Convey("record unmatched request", t, func() {
+		doHTTPRequest("GET", "/does-not-exist", "", nil)
+		entries := j.Find(&JournalFilter{Path: "/does-not-exist"})
+		So(len(entries), ShouldEqual, 1)
+		So(entries[0].Route, ShouldEqual, "")
+		So(entries[0].Response.Code, ShouldEqual, 404)
+	})
+
+	Convey("limit recorded bodies", t, func() {
+		big := strings.Repeat("a", JournalBodyLimit+10)
+		h := journalHandler(j, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/binary" {
+				w.Header().Set("Content-Type", "application/pdf")
+				w.Write([]byte("%PDF-1.4"))
+				return
+			}
+			w.Write([]byte(big))
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/big", strings.NewReader(big)))
+		e := j.Find(&JournalFilter{Path: "/big"})[0]
+		So(len(e.Body), ShouldEqual, JournalBodyLimit)
+		So(len(e.Response.Body), ShouldEqual, JournalBodyLimit)
+		So(e.Response.Size, ShouldEqual, len(big))
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/binary", nil))
+		e = j.Find(&JournalFilter{Path: "/binary"})[0]
+		So(e.Response.Body, ShouldBeEmpty)
+		So(e.Response.Size, ShouldEqual, 8)
+	})
+
+	Convey("encode bodies which are not UTF-8 text in base64", t, func() {
+		cut := strings.Repeat("a", JournalBodyLimit-1) + "é"
+		h := journalHandler(j, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(cut))
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/latin1", strings.NewReader("caf\xe9")))
+		e := j.Find(&JournalFilter{Path: "/latin1"})[0]
+		So(e.Body, ShouldEqual, "Y2Fm6Q==")
+		So(e.Encoding, ShouldEqual, "base64")
+		So(e.Response.Body, ShouldEqual, cut[:JournalBodyLimit-1])
+		So(e.Response.Encoding, ShouldBeEmpty)
+	})
+}
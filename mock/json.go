@@ -0,0 +1,516 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v3"
+)
+
+// convert interface{} to json bytes
+func MarshalJSON(d interface{}) ([]byte, error) {
+	v, err := convertMapKeyToString(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// unmarshalJSON decodes data into out, numbers are kept as json.Number
+func unmarshalJSON(data []byte, out interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return decoder.Decode(out)
+}
+
+// decodeOrderedJSON decodes JSON data keeping key order and numbers as written
+func decodeOrderedJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	v, err := decodeOrderedValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid JSON: data after top-level value")
+	}
+
+	return v, nil
+}
+
+func decodeOrderedValue(decoder *json.Decoder) (interface{}, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := newOrderedMap()
+			for decoder.More() {
+				k, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := decodeOrderedValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				m.set(k.(string), v)
+			}
+			_, err := decoder.Token() // }
+			return m, err
+		case '[':
+			s := []interface{}{}
+			for decoder.More() {
+				v, err := decodeOrderedValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				s = append(s, v)
+			}
+			_, err := decoder.Token() // ]
+			return s, err
+		}
+	case json.Number:
+		return number(t), nil
+	}
+
+	return tok, nil
+}
+
+// keyString converts map key to string, eg. 1 to "1" and nil to "null"
+func keyString(k interface{}) string {
+	switch k := k.(type) {
+	case nil:
+		return "null"
+	case string:
+		return k
+	}
+
+	return fmt.Sprint(k)
+}
+
+func convertMapKeyToString(d interface{}) (interface{}, error) {
+	switch v := reflect.ValueOf(d); v.Kind() {
+	case reflect.Map:
+		// As json.Marshal does not support map[interface{}]interface{}, should convert key to string type
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			ik := iter.Key().Interface()
+			iv, err := convertMapKeyToString(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			m[keyString(ik)] = iv
+		}
+		return m, nil
+	case reflect.Slice:
+		s := make([]interface{}, v.Len())
+		for idx := 0; idx < v.Len(); idx++ {
+			sv, err := convertMapKeyToString(v.Index(idx).Interface())
+			if err != nil {
+				return nil, err
+			}
+			s[idx] = sv
+		}
+		return s, nil
+	}
+
+	return d, nil
+}
+
+// orderedMap is a JSON object keeping key order as in YAML
+type orderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedMap() *orderedMap {
+	return &orderedMap{values: map[string]interface{}{}}
+}
+
+// set sets value of key, new keys are appended
+func (m *orderedMap) set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *orderedMap) delete(key string) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+	delete(m.values, key)
+	for idx, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:idx:idx], m.keys[idx+1:]...)
+			break
+		}
+	}
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBufferString("{")
+	for idx, k := range m.keys {
+		if idx > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := MarshalJSON(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (m *orderedMap) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, k := range m.keys {
+		value := &yaml.Node{}
+		if err := value.Encode(m.values[k]); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, value)
+	}
+
+	return node, nil
+}
+
+// number is a number as written in YAML, eg. 12345678901234567890 or 1.50
+type number string
+
+func (n number) MarshalJSON() ([]byte, error) {
+	return []byte(n), nil
+}
+
+func (n number) MarshalYAML() (interface{}, error) {
+	tag := "!!int"
+	if strings.ContainsAny(string(n), ".eE") {
+		tag = "!!float"
+	}
+
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(n)}, nil
+}
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][+-]?\d+)?$`)
+
+// yamlToJSON decodes YAML node as JSON data, objects keep key order, keys are
+// strings as written and numbers are kept as written if valid in JSON
+func yamlToJSON(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlToJSON(node.Content[0])
+	case yaml.AliasNode:
+		return yamlToJSON(node.Alias)
+	case yaml.SequenceNode:
+		s := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			v, err := yamlToJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		return s, nil
+	case yaml.MappingNode:
+		m := newOrderedMap()
+		for idx := 0; idx+1 < len(node.Content); idx += 2 {
+			k, v := node.Content[idx], node.Content[idx+1]
+			if k.ShortTag() == "!!merge" {
+				if err := yamlMerge(m, v); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			key, err := yamlKey(k)
+			if err != nil {
+				return nil, err
+			}
+			value, err := yamlToJSON(v)
+			if err != nil {
+				return nil, err
+			}
+			m.set(key, value)
+		}
+		return m, nil
+	}
+
+	switch node.ShortTag() {
+	case "!!str":
+		return node.Value, nil
+	case "!!int", "!!float":
+		if jsonNumber.MatchString(node.Value) {
+			return number(node.Value), nil
+		}
+	}
+	var v interface{}
+	if err := node.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// yamlField decodes value of key in mapping node into v by yamlToJSON, v is
+// kept if key is not set
+func yamlField(node *yaml.Node, key string, v *interface{}) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			value, err := yamlToJSON(node.Content[idx+1])
+			if err != nil {
+				return err
+			}
+			*v = value
+		}
+	}
+
+	return nil
+}
+
+// yamlMerge merges mappings of merge key (<<) into m, keys set explicitly win
+func yamlMerge(m *orderedMap, node *yaml.Node) error {
+	nodes := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		nodes = node.Content
+	}
+	for _, n := range nodes {
+		v, err := yamlToJSON(n)
+		if err != nil {
+			return err
+		}
+		merged, ok := v.(*orderedMap)
+		if !ok {
+			return fmt.Errorf("line %d: merge value is not a mapping", n.Line)
+		}
+		for _, k := range merged.keys {
+			if _, exists := m.values[k]; !exists {
+				m.set(k, merged.values[k])
+			}
+		}
+	}
+
+	return nil
+}
+
+// yamlKey returns key as written, non-scalar keys are converted to JSON
+func yamlKey(node *yaml.Node) (string, error) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode {
+		if node.ShortTag() == "!!null" {
+			return "null", nil
+		}
+		return node.Value, nil
+	}
+	v, err := yamlToJSON(node)
+	if err != nil {
+		return "", err
+	}
+	data, err := MarshalJSON(v)
+
+	return string(data), err
+}
+
+// jsonTemplate is structured data with templated strings, which is rendered
+// into values before marshaling, so that strings are escaped properly. A
+// string of a single template action keeps the type of its value, eg.
+// "${age}" renders number 20 rather than string "20".
+type jsonTemplate struct {
+	kind   int
+	value  interface{}     // static value
+	text   *textTemplate   // templated string
+	fields []*jsonField    // templated object
+	items  []*jsonTemplate // templated array
+}
+
+type jsonField struct {
+	key   *textTemplate
+	value *jsonTemplate
+}
+
+const (
+	jsonStatic = iota
+	jsonText   // string rendered as text
+	jsonValue  // single action rendered as JSON of its value
+	jsonObject
+	jsonArray
+)
+
+func newJSONTemplate(d interface{}) (*jsonTemplate, error) {
+	v, err := convertMapKeyToString(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return compileJSON(v)
+}
+
+func compileJSON(v interface{}) (*jsonTemplate, error) {
+	switch v := v.(type) {
+	case string:
+		return compileJSONString(v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return compileJSONObject(v, keys, v)
+	case *orderedMap:
+		return compileJSONObject(v, v.keys, v.values)
+	case []interface{}:
+		t := &jsonTemplate{kind: jsonArray}
+		static := true
+		for idx, item := range v {
+			value, err := compileJSON(item)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", idx, err)
+			}
+			static = static && value.kind == jsonStatic
+			t.items = append(t.items, value)
+		}
+		if static {
+			return &jsonTemplate{value: v}, nil
+		}
+		return t, nil
+	}
+
+	return &jsonTemplate{value: v}, nil
+}
+
+// compileJSONObject compiles fields of object v in order of keys
+func compileJSONObject(v interface{}, keys []string, values map[string]interface{}) (*jsonTemplate, error) {
+	t := &jsonTemplate{kind: jsonObject}
+	static := true
+	for _, k := range keys {
+		key, err := newTextTemplate(k)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", k, err)
+		}
+		value, err := compileJSON(values[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", k, err)
+		}
+		static = static && key.tpl == nil && value.kind == jsonStatic
+		t.fields = append(t.fields, &jsonField{key: key, value: value})
+	}
+	if static {
+		return &jsonTemplate{value: v}, nil
+	}
+
+	return t, nil
+}
+
+// compileJSONString compiles a single action as {{toJson (pipeline)}}, and
+// other templated strings as text
+func compileJSONString(s string) (*jsonTemplate, error) {
+	text, err := newTextTemplate(s)
+	if err != nil {
+		return nil, err
+	}
+	if text.tpl == nil {
+		return &jsonTemplate{value: s}, nil
+	}
+	if nodes := text.tpl.Tree.Root.Nodes; len(nodes) == 1 {
+		if action, ok := nodes[0].(*parse.ActionNode); ok && len(action.Pipe.Decl) == 0 {
+			tpl, err := parseTemplate("{{toJson (" + action.Pipe.String() + ")}}")
+			if err == nil {
+				return &jsonTemplate{kind: jsonValue, text: &textTemplate{text: s, tpl: tpl}}, nil
+			}
+		}
+	}
+
+	return &jsonTemplate{kind: jsonText, text: text}, nil
+}
+
+// render returns value of data rendered with params
+func (t *jsonTemplate) render(params map[string]interface{}) (interface{}, error) {
+	switch t.kind {
+	case jsonText:
+		return t.text.render(params)
+	case jsonValue:
+		data, err := t.text.render(params)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		return v, unmarshalJSON([]byte(data), &v)
+	case jsonObject:
+		m := newOrderedMap()
+		for _, f := range t.fields {
+			k, err := f.key.render(params)
+			if err != nil {
+				return nil, err
+			}
+			v, err := f.value.render(params)
+			if err != nil {
+				return nil, err
+			}
+			m.set(k, v)
+		}
+		return m, nil
+	case jsonArray:
+		s := make([]interface{}, len(t.items))
+		for idx, item := range t.items {
+			v, err := item.render(params)
+			if err != nil {
+				return nil, err
+			}
+			s[idx] = v
+		}
+		return s, nil
+	}
+
+	return t.value, nil
+}
+
+// renderTo renders data with params, and decodes it into out as JSON
+func (t *jsonTemplate) renderTo(params map[string]interface{}, out interface{}) error {
+	rendered, err := t.marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalJSON([]byte(rendered), out)
+}
+
+// marshal renders data with params, and marshals it as JSON
+func (t *jsonTemplate) marshal(params map[string]interface{}) (string, error) {
+	v, err := t.render(params)
+	if err != nil {
+		return "", err
+	}
+	data, err := MarshalJSON(v)
+
+	return string(data), err
+}
@@ -0,0 +1,156 @@
+package mock
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	Convey("marshal string", t, func() {
+		v, err := MarshalJSON("hello world")
+		So(err, ShouldBeNil)
+		So(string(v), ShouldEqual, "\"hello world\"")
+	})
+
+	Convey("marshal simple map", t, func() {
+		v, err := MarshalJSON(map[interface{}]interface{}{
+			"hello": "world",
+		})
+		So(err, ShouldBeNil)
+		So(string(v), ShouldEqual, "{\"hello\":\"world\"}")
+	})
+
+	Convey("marshal nested map", t, func() {
+		v, err := MarshalJSON(map[interface{}]interface{}{
+			"hello": "world",
+			"sub": map[interface{}]interface{}{
+				"one":     "value",
+				"another": 2,
+			},
+		})
+		So(err, ShouldBeNil)
+		So(string(v), ShouldEqual, "{\"hello\":\"world\",\"sub\":{\"another\":2,\"one\":\"value\"}}")
+	})
+
+	Convey("marshal array", t, func() {
+		v, err := MarshalJSON([]interface{}{
+			"abcde",
+			map[interface{}]interface{}{
+				"hello": "world",
+			},
+		})
+		So(err, ShouldBeNil)
+		So(string(v), ShouldEqual, "[\"abcde\",{\"hello\":\"world\"}]")
+	})
+
+	Convey("marshal nested array", t, func() {
+		v, err := MarshalJSON([]interface{}{
+			"abcde",
+			map[interface{}]interface{}{
+				"hello": []interface{}{
+					1, 2, "a",
+				},
+			},
+		})
+		So(err, ShouldBeNil)
+		So(string(v), ShouldEqual, "[\"abcde\",{\"hello\":[1,2,\"a\"]}]")
+	})
+}
+
+func TestJSONTemplate(t *testing.T) {
+	params := map[string]interface{}{
+		"name":     `say "hi"`,
+		"age":      20,
+		"vip":      true,
+		"page":     "2",
+		"location": map[string]interface{}{"city": "hangzhou"},
+		"tags":     []interface{}{"a", "b"},
+	}
+	marshal := func(body interface{}) string {
+		tpl, err := newJSONTemplate(body)
+		So(err, ShouldBeNil)
+		data, err := tpl.marshal(params)
+		So(err, ShouldBeNil)
+		return data
+	}
+
+	Convey("keep native type of single action", t, func() {
+		So(marshal(map[string]interface{}{
+			"age":      "${age}",
+			"vip":      "{{.vip}}",
+			"page":     "${page}",
+			"location": "${location}",
+			"tags":     "{{ .tags }}",
+			"next":     "${add .page 1}",
+			"missing":  "${none}",
+		}), ShouldEqual, `{"age":20,"location":{"city":"hangzhou"},"missing":null,"next":3,"page":"2","tags":["a","b"],"vip":true}`)
+	})
+
+	Convey("escape rendered strings", t, func() {
+		So(marshal(map[interface{}]interface{}{
+			"greeting": "${name}!",
+			"items":    []interface{}{"${name}", 1, map[interface{}]interface{}{"${page}": "age ${age}"}},
+		}), ShouldEqual, `{"greeting":"say \"hi\"!","items":["say \"hi\"",1,{"2":"age 20"}]}`)
+	})
+
+	Convey("keep static data", t, func() {
+		body := map[string]interface{}{"a": []interface{}{1, "b"}, "{": "}"}
+		tpl, err := newJSONTemplate(body)
+		So(err, ShouldBeNil)
+		So(tpl.kind, ShouldEqual, jsonStatic)
+		So(marshal(body), ShouldEqual, `{"a":[1,"b"],"{":"}"}`)
+	})
+
+	Convey("report template errors", t, func() {
+		_, err := newJSONTemplate(map[string]interface{}{"a": []interface{}{"{{.b"}})
+		So(err, ShouldBeNil)
+		_, err = newJSONTemplate(map[string]interface{}{"a": []interface{}{"{{.b}"}})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "a: 0: ")
+	})
+}
+
+func TestYAMLToJSON(t *testing.T) {
+	convert := func(doc string) string {
+		var node yaml.Node
+		So(yaml.Unmarshal([]byte(doc), &node), ShouldBeNil)
+		v, err := yamlToJSON(&node)
+		So(err, ShouldBeNil)
+		data, err := MarshalJSON(v)
+		So(err, ShouldBeNil)
+		return string(data)
+	}
+
+	Convey("keep key order", t, func() {
+		So(convert("b: 1\na: {d: x, c: [z, y]}\n"), ShouldEqual, `{"b":1,"a":{"d":"x","c":["z","y"]}}`)
+	})
+
+	Convey("convert non-string keys", t, func() {
+		So(convert("1: a\ntrue: b\n~: c\n1.50: d\n[x, y]: e\n"), ShouldEqual, `{"1":"a","true":"b","null":"c","1.50":"d","[\"x\",\"y\"]":"e"}`)
+	})
+
+	Convey("keep numbers as written", t, func() {
+		So(convert("big: 12345678901234567890\nprice: 1.50\nexp: 1e3\nneg: -0.0\nhex: 0x1F\nsep: 1_000\n"), ShouldEqual, `{"big":12345678901234567890,"price":1.50,"exp":1e3,"neg":-0.0,"hex":31,"sep":1000}`)
+	})
+
+	Convey("resolve aliases and merge keys", t, func() {
+		So(convert("base: &base {a: 1, b: 2}\nitem:\n  <<: *base\n  b: 3\n  c: *base\n"), ShouldEqual, `{"base":{"a":1,"b":2},"item":{"a":1,"b":3,"c":{"a":1,"b":2}}}`)
+	})
+
+	Convey("marshal back to YAML", t, func() {
+		var node yaml.Node
+		So(yaml.Unmarshal([]byte("b: 1.50\na: {\"1\": x, \"true\": y}\n"), &node), ShouldBeNil)
+		v, _ := yamlToJSON(&node)
+		data, err := yaml.Marshal(v)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "b: 1.50\na:\n    \"1\": x\n    \"true\": \"y\"\n")
+	})
+
+	Convey("marshal non-string keys of Go maps", t, func() {
+		v, err := MarshalJSON(map[interface{}]interface{}{1: "a", true: "b", nil: "c"})
+		So(err, ShouldBeNil)
+		So(string(v), ShouldEqual, `{"1":"a","null":"c","true":"b"}`)
+	})
+}
@@ -0,0 +1,273 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// request matchers example
+//
+// routes:
+//   - uri: /api
+//     request:
+//       headers:
+//         X-Tenant: acme # same as {equals: acme}
+//         Authorization: {regex: "^Bearer "}
+//       cookies:
+//         session: {exists: true}
+//       query:
+//         debug: {exists: false} # absent
+//         page: "" # present and empty
+//       body: # JSON body, keyed by JSONPath
+//         $.user.name: {regex: "^a"}
+//         $.items[0].id: 1
+
+// HttpRequest matches a request, all matchers must match
+type HttpRequest struct {
+	Headers map[string]*Matcher `yaml:"headers,omitempty"`
+	Cookies map[string]*Matcher `yaml:"cookies,omitempty"`
+	Query   map[string]*Matcher `yaml:"query,omitempty"`
+	Body    map[string]*Matcher `yaml:"body,omitempty"` // keyed by JSONPath, "$" is the whole body
+}
+
+// Matcher matches a value. A scalar in YAML is short for equals.
+type Matcher struct {
+	Equals *string `yaml:"equals,omitempty"` // "" matches empty value only
+	Regex  string  `yaml:"regex,omitempty"`
+	Exists *bool   `yaml:"exists,omitempty"` // false matches absent value only
+
+	re *regexp.Regexp
+}
+
+func (m *Matcher) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		value := node.Value
+		m.Equals = &value
+		return nil
+	}
+	type plain Matcher
+
+	return node.Decode((*plain)(m))
+}
+
+func (r *HttpRequest) clone() *HttpRequest {
+	if r == nil {
+		return nil
+	}
+
+	return &HttpRequest{Headers: cloneMatchers(r.Headers), Cookies: cloneMatchers(r.Cookies), Query: cloneMatchers(r.Query), Body: cloneMatchers(r.Body)}
+}
+
+func cloneMatchers(matchers map[string]*Matcher) map[string]*Matcher {
+	if matchers == nil {
+		return nil
+	}
+	clones := make(map[string]*Matcher, len(matchers))
+	for k, m := range matchers {
+		clones[k] = m.clone()
+	}
+
+	return clones
+}
+
+func (m *Matcher) clone() *Matcher {
+	if m == nil {
+		return nil
+	}
+	c := *m
+
+	return &c
+}
+
+// compile compiles regex of matchers, set only when all compile
+func (r *HttpRequest) compile() error {
+	if r == nil {
+		return nil
+	}
+	var assign []func()
+	for _, matchers := range []map[string]*Matcher{r.Headers, r.Cookies, r.Query, r.Body} {
+		for key, m := range matchers {
+			if err := m.compile(key, &assign); err != nil {
+				return err
+			}
+		}
+	}
+	for _, set := range assign {
+		set()
+	}
+
+	return nil
+}
+
+// compile compiles regex of matcher, and adds setting it to assign. key is
+// for error message.
+func (m *Matcher) compile(key string, assign *[]func()) error {
+	if m == nil {
+		return fmt.Errorf("matcher of %s is empty", key)
+	}
+	var re *regexp.Regexp
+	if m.Regex != "" {
+		var err error
+		if re, err = regexp.Compile(m.Regex); err != nil {
+			return fmt.Errorf("invalid regex of %s: %v", key, err)
+		}
+	}
+	*assign = append(*assign, func() { m.re = re })
+
+	return nil
+}
+
+// Match reports whether request matches, nil matches all requests
+func (r *HttpRequest) Match(req *http.Request) bool {
+	if r == nil {
+		return true
+	}
+	for key, m := range r.Headers {
+		values := req.Header.Values(key)
+		if !m.match(strings.Join(values, ","), len(values) > 0) {
+			return false
+		}
+	}
+	for key, m := range r.Cookies {
+		cookie, err := req.Cookie(key)
+		value := ""
+		if err == nil {
+			value = cookie.Value
+		}
+		if !m.match(value, err == nil) {
+			return false
+		}
+	}
+	query := req.URL.Query()
+	for key, m := range r.Query {
+		_, exists := query[key]
+		if !m.match(query.Get(key), exists) {
+			return false
+		}
+	}
+	if len(r.Body) > 0 {
+		data := readBody(req)
+		var body interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			body = string(data) // not JSON, only "$" matches raw body
+		}
+		for path, m := range r.Body {
+			v, exists := jsonPath(body, path)
+			if !m.match(jsonString(v), exists) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (m *Matcher) match(value string, exists bool) bool {
+	if m.Exists != nil && *m.Exists != exists {
+		return false
+	}
+	if !exists {
+		return m.Exists != nil || (m.Equals == nil && m.Regex == "")
+	}
+	if m.Equals != nil && value != *m.Equals {
+		return false
+	}
+	if m.re != nil && !m.re.MatchString(value) {
+		return false
+	}
+
+	return true
+}
+
+// capture adds values of named regex groups in value to params
+func (m *Matcher) capture(value string, params map[string]interface{}) {
+	if m.re == nil {
+		return
+	}
+	groups := m.re.FindStringSubmatch(value)
+	for idx, name := range m.re.SubexpNames() {
+		if name != "" && idx < len(groups) {
+			params[name] = groups[idx]
+		}
+	}
+}
+
+// readBody reads request body, and restores it for later readers
+func readBody(r *http.Request) []byte {
+	if r.Body == nil {
+		return nil
+	}
+	data, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	return data
+}
+
+// jsonString returns string of JSON value, strings are not quoted
+func jsonString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	data, _ := json.Marshal(v)
+
+	return string(data)
+}
+
+var jsonPathToken = regexp.MustCompile(`\.([^.\[]+)|\[(\d+)\]|\['([^']*)'\]`)
+
+// jsonPath returns value of data at path, eg. $.items[0].id or $['a.b']
+func jsonPath(data interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(path, "$")
+	if path != "" && !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "[") {
+		path = "." + path
+	}
+	tokens := jsonPathToken.FindAllStringSubmatchIndex(path, -1)
+	end := 0
+	for _, t := range tokens {
+		if t[0] != end {
+			return nil, false
+		}
+		end = t[1]
+		switch {
+		case t[4] >= 0: // [n]
+			items, ok := data.([]interface{})
+			idx, _ := strconv.Atoi(path[t[4]:t[5]])
+			if !ok || idx >= len(items) {
+				return nil, false
+			}
+			data = items[idx]
+		default: // .key or ['key']
+			key := ""
+			if t[2] >= 0 {
+				key = path[t[2]:t[3]]
+			} else {
+				key = path[t[6]:t[7]]
+			}
+			m, ok := data.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if data, ok = m[key]; !ok {
+				return nil, false
+			}
+		}
+	}
+	if end != len(path) {
+		return nil, false
+	}
+
+	return data, true
+}
@@ -0,0 +1,176 @@
+package mock
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONPath(t *testing.T) {
+	data := map[string]interface{}{
+		"user":  map[string]interface{}{"name": "alice"},
+		"items": []interface{}{map[string]interface{}{"id": 1}},
+		"a.b":   true,
+	}
+
+	Convey("get value at path", t, func() {
+		v, ok := jsonPath(data, "$.user.name")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldEqual, "alice")
+		v, ok = jsonPath(data, "user.name")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldEqual, "alice")
+		v, ok = jsonPath(data, "$.items[0].id")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldEqual, 1)
+		v, ok = jsonPath(data, "$['a.b']")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldEqual, true)
+		v, ok = jsonPath(data, "$")
+		So(ok, ShouldBeTrue)
+		So(v, ShouldResemble, data)
+	})
+
+	Convey("missing path", t, func() {
+		for _, path := range []string{"$.user.age", "$.items[1]", "$.user[0]", "$.items.id", "$.user..name"} {
+			_, ok := jsonPath(data, path)
+			So(ok, ShouldBeFalse)
+		}
+	})
+}
+
+func TestRequestMatchers(t *testing.T) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+default:
+  code: 418
+  body: no match
+routes:
+  - uri: /orders
+    method: POST
+    request:
+      headers:
+        X-Tenant: acme
+      body:
+        $.items[0].qty: 2
+        $.user.name: {regex: "^a"}
+    response:
+      body: acme order
+  - uri: /orders
+    method: POST
+    request:
+      cookies:
+        session: {exists: true}
+      query:
+        dry: {exists: false}
+    response:
+      body: session order
+  - uri: /orders
+    method: POST
+    response:
+      code: 400
+      body: fallback order
+  - uri: /users
+    request:
+      headers:
+        Authorization: {regex: "^Bearer "}
+    response:
+      body: users
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+
+	doRequest := func(req *http.Request) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		body, _ := io.ReadAll(w.Result().Body)
+		return w.Code, string(body)
+	}
+
+	Convey("match headers and JSON body", t, func() {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"user": {"name": "alice"}, "items": [{"qty": 2}]}`))
+		req.Header.Set("X-Tenant", "acme")
+		code, body := doRequest(req)
+		So(code, ShouldEqual, 200)
+		So(body, ShouldEqual, "acme order")
+	})
+
+	Convey("try routes in declared order", t, func() {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(`{"user": {"name": "bob"}, "items": [{"qty": 2}]}`))
+		req.Header.Set("X-Tenant", "acme")
+		req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		code, body := doRequest(req)
+		So(code, ShouldEqual, 200)
+		So(body, ShouldEqual, "session order")
+
+		req = httptest.NewRequest("POST", "/orders?dry=1", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		code, body = doRequest(req)
+		So(code, ShouldEqual, 400)
+		So(body, ShouldEqual, "fallback order")
+	})
+
+	Convey("fall through to default response", t, func() {
+		req := httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set("Authorization", "Basic abc")
+		code, body := doRequest(req)
+		So(code, ShouldEqual, 418)
+		So(body, ShouldEqual, "no match")
+
+		code, _ = doRequest(httptest.NewRequest("GET", "/not-found", nil))
+		So(code, ShouldEqual, 418)
+
+		req = httptest.NewRequest("GET", "/users", nil)
+		req.Header.Set("Authorization", "Bearer abc")
+		code, body = doRequest(req)
+		So(code, ShouldEqual, 200)
+		So(body, ShouldEqual, "users")
+	})
+
+	Convey("match empty value to equal", t, func() {
+		empty := ""
+		m := &Matcher{Equals: &empty}
+		So(m.match("", true), ShouldBeTrue)
+		So(m.match("a", true), ShouldBeFalse)
+		So(m.match("", false), ShouldBeFalse)
+		So((&Matcher{}).match("a", true), ShouldBeTrue)
+
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /a\n    request:\n      query:\n        id: ''\n    response: {body: empty}\n")), ShouldBeNil)
+		So(s.initRoutes(), ShouldBeNil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/a?id=", nil))
+		So(w.Body.String(), ShouldEqual, "empty")
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/a?id=1", nil))
+		So(w.Code, ShouldEqual, 404)
+	})
+
+	Convey("keep compiled matchers if any regex is invalid", t, func() {
+		r := &HttpRequest{Headers: map[string]*Matcher{"A": {Regex: "^a"}}, Query: map[string]*Matcher{"b": {Regex: "^b"}}}
+		So(r.compile(), ShouldBeNil)
+		re := r.Headers["A"].re
+		So(re, ShouldNotBeNil)
+		r.Headers["A"].Regex = "^c"
+		r.Query["b"].Regex = "("
+		So(r.compile(), ShouldNotBeNil)
+		So(r.Headers["A"].re, ShouldEqual, re)
+		So(r.Headers["A"].match("a", true), ShouldBeTrue)
+	})
+
+	Convey("report invalid regex with line", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /hello\n    request:\n      query:\n        id: {regex: \"(\"}\n")), ShouldBeNil)
+		err := s.initRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, "line 2: invalid regex of id")
+	})
+}
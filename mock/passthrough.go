@@ -0,0 +1,264 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gookit/slog"
+	"gopkg.in/yaml.v3"
+)
+
+// passthrough route example, request is forwarded to upstream and the
+// response is patched, patches are rendered as templates
+//
+// routes:
+//   - uri: /users/:id
+//     passthrough:
+//       upstream: http://127.0.0.1:8080
+//       timeout: 3000 # in milliseconds, 504 on timeout
+//       headers: # set on request, removed if empty
+//         Authorization: Bearer token
+//       code: 200 # override status code
+//       delay: 500 # add latency in milliseconds
+//       responseHeaders: # set on response, removed if empty
+//         X-User: ${id}
+//       mergePatch: # JSON merge patch (RFC 7386) of JSON body
+//         mocked: true
+//         secret: null # removed
+//       jsonPatch: # JSON Patch (RFC 6902) of JSON body, applied after merge patch
+//         - {op: add, path: /tags/-, value: "${id}"}
+//       replace: # regex replace of body, $1 expands to group
+//         - regex: "prod-(\\w+)"
+//           with: test-$1
+
+// HttpPassthrough forwards request to upstream and patches response
+type HttpPassthrough struct {
+	Upstream        string            `yaml:"upstream"`
+	Timeout         int               `yaml:"timeout,omitempty"`
+	Headers         map[string]string `yaml:"headers,omitempty"`
+	Code            int               `yaml:"code,omitempty"`
+	Delay           int               `yaml:"delay,omitempty"`
+	ResponseHeaders map[string]string `yaml:"responseHeaders,omitempty"`
+	MergePatch      interface{}       `yaml:"mergePatch,omitempty"`
+	JsonPatch       []*JsonPatchOp    `yaml:"jsonPatch,omitempty"`
+	Replace         []*TextReplace    `yaml:"replace,omitempty"`
+
+	compiled *compiledPassthrough // replaced as a whole on compile, never changed in place
+}
+
+// compiledPassthrough is handler and patches compiled from HttpPassthrough
+type compiledPassthrough struct {
+	handler         http.Handler
+	responseHeaders map[string]*textTemplate
+	mergePatch      *jsonTemplate
+	jsonPatch       *jsonTemplate
+	replaces        []*compiledReplace
+}
+
+// TextReplace replaces all matches of regex in body
+type TextReplace struct {
+	Regex string `yaml:"regex"`
+	With  string `yaml:"with"`
+}
+
+type compiledReplace struct {
+	re   *regexp.Regexp
+	with *textTemplate
+}
+
+type passthroughKey struct{}
+
+// UnmarshalYAML decodes merge patch keeping key order and numbers as written
+// in YAML
+func (p *HttpPassthrough) UnmarshalYAML(node *yaml.Node) error {
+	type plain HttpPassthrough
+	if err := node.Decode((*plain)(p)); err != nil {
+		return err
+	}
+
+	return yamlField(node, "mergePatch", &p.MergePatch)
+}
+
+func (p *HttpPassthrough) clone() *HttpPassthrough {
+	if p == nil {
+		return nil
+	}
+	c := *p
+
+	return &c
+}
+
+func (p *HttpPassthrough) compile() error {
+	c := &compiledPassthrough{responseHeaders: make(map[string]*textTemplate, len(p.ResponseHeaders))}
+	for k, v := range p.ResponseHeaders {
+		t, err := newTextTemplate(v)
+		if err != nil {
+			return fmt.Errorf("response header %s: %v", k, err)
+		}
+		c.responseHeaders[k] = t
+	}
+	if p.MergePatch != nil {
+		t, err := newJSONDocTemplate(p.MergePatch)
+		if err != nil {
+			return fmt.Errorf("merge patch: %v", err)
+		}
+		c.mergePatch = t
+	}
+	for idx, op := range p.JsonPatch {
+		if op == nil {
+			return fmt.Errorf("JSON patch %d is empty", idx)
+		}
+		if err := op.compile(); err != nil {
+			return err
+		}
+	}
+	if len(p.JsonPatch) > 0 {
+		t, err := newJSONDocTemplate(p.JsonPatch)
+		if err != nil {
+			return fmt.Errorf("JSON patch: %v", err)
+		}
+		c.jsonPatch = t
+	}
+	for idx, r := range p.Replace {
+		if r == nil {
+			return fmt.Errorf("replace %d is empty", idx)
+		}
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex of replace %d: %v", idx, err)
+		}
+		with, err := newTextTemplate(r.With)
+		if err != nil {
+			return fmt.Errorf("replace %d: %v", idx, err)
+		}
+		c.replaces = append(c.replaces, &compiledReplace{re: re, with: with})
+	}
+
+	proxy, err := newReverseProxy(p.Upstream, p.Timeout, p.Headers)
+	if err != nil {
+		return err
+	}
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		if p.patchesBody() {
+			// let transport handle compression, so that plain body is patched
+			r.Header.Del("Accept-Encoding")
+		}
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		return p.modify(c, resp)
+	}
+	c.handler = forward(proxy, p.Upstream, p.Timeout)
+	p.compiled = c
+
+	return nil
+}
+
+func (p *HttpPassthrough) patchesBody() bool {
+	return p.MergePatch != nil || len(p.JsonPatch) > 0 || len(p.Replace) > 0
+}
+
+// serve forwards request, params are used to render patches
+func (p *HttpPassthrough) serve(w http.ResponseWriter, r *http.Request, params map[string]interface{}) {
+	p.compiled.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), passthroughKey{}, params)))
+}
+
+// modify patches upstream response with compiled c
+func (p *HttpPassthrough) modify(c *compiledPassthrough, resp *http.Response) error {
+	ctx := resp.Request.Context()
+	params, _ := ctx.Value(passthroughKey{}).(map[string]interface{})
+
+	if p.Code > 0 {
+		resp.StatusCode = p.Code
+		resp.Status = fmt.Sprintf("%d %s", p.Code, http.StatusText(p.Code))
+	}
+	for k, v := range c.responseHeaders {
+		rv, err := v.render(params)
+		if err != nil {
+			slog.Errorf("render header value %s error: %v", v.text, err)
+		}
+		setHeaders(resp.Header, map[string]string{k: rv})
+	}
+	if p.patchesBody() {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if data, err = c.patch(data, params); err != nil {
+			return err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		resp.ContentLength = int64(len(data))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	}
+	if !sleep(ctx, p.Delay) {
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// patch applies patches of JSON body, and then replaces of text. Key order
+// and numbers of upstream body are kept.
+func (c *compiledPassthrough) patch(data []byte, params map[string]interface{}) ([]byte, error) {
+	if c.mergePatch != nil || c.jsonPatch != nil {
+		if doc, err := decodeOrderedJSON(data); err != nil {
+			slog.Warnf("skip JSON patches of non-JSON body: %v", err)
+		} else {
+			if c.mergePatch != nil {
+				rendered, err := c.mergePatch.marshal(params)
+				if err != nil {
+					return nil, err
+				}
+				patch, err := decodeOrderedJSON([]byte(rendered))
+				if err != nil {
+					return nil, err
+				}
+				doc = mergePatch(doc, patch)
+			}
+			if c.jsonPatch != nil {
+				var ops []*JsonPatchOp
+				if err := c.jsonPatch.renderTo(params, &ops); err != nil {
+					return nil, err
+				}
+				if doc, err = jsonPatch(doc, ops); err != nil {
+					return nil, err
+				}
+			}
+			if data, err = MarshalJSON(doc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, r := range c.replaces {
+		with, err := r.with.render(params)
+		if err != nil {
+			slog.Errorf("render replace %s error: %v", r.with.text, err)
+		}
+		data = r.re.ReplaceAll(data, []byte(with))
+	}
+
+	return data, nil
+}
+
+// newJSONDocTemplate compiles v converted to decoded JSON, so that strings in
+// structs are templated too
+func newJSONDocTemplate(v interface{}) (*jsonTemplate, error) {
+	data, err := MarshalJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := decodeOrderedJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return newJSONTemplate(doc)
+}
@@ -0,0 +1,123 @@
+package mock
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPassthrough(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Server-Header", "upstream")
+		if strings.HasPrefix(r.URL.Path, "/text") {
+			fmt.Fprintf(w, "prod-api %s %s auth=%s", r.Method, body, r.Header.Get("Authorization"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": 1, "secret": "s", "tags": ["a"], "path": %q, "body": %q}`, r.URL.Path, body)
+	}))
+	defer upstream.Close()
+
+	s := NewHttpServer()
+	err := s.Load([]byte(fmt.Sprintf(`
+routes:
+  - uri: /users/:id
+    method: POST
+    passthrough:
+      upstream: %[1]s
+      code: 201
+      responseHeaders:
+        X-User: ${id}
+        Server-Header: ""
+      mergePatch:
+        mocked: true
+        user: ${id}
+        secret: null
+      jsonPatch:
+        - {op: add, path: /tags/-, value: "${id}"}
+        - {op: test, path: /id, value: 1}
+  - uri: /text
+    method: POST
+    passthrough:
+      upstream: %[1]s
+      headers:
+        Authorization: Bearer token
+      delay: 100
+      replace:
+        - regex: "prod-(\\w+)"
+          with: test-$1
+  - uri: /broken
+    passthrough:
+      upstream: %[1]s
+      jsonPatch:
+        - {op: test, path: /id, value: 2}
+`, upstream.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method string, uri string, body string, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, uri, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		journalHandler(RequestJournal, s).ServeHTTP(w, req)
+		return w
+	}
+
+	Convey("patch JSON response", t, func() {
+		w := do("POST", "/users/42", `{"name": "alice"}`, "application/json")
+		So(w.Code, ShouldEqual, 201)
+		So(w.Header().Get("X-User"), ShouldEqual, "42")
+		So(w.Header().Get("Server-Header"), ShouldBeEmpty)
+		So(decodeJSON(w.Body.String()), ShouldResemble, decodeJSON(
+			`{"id": 1, "tags": ["a", "42"], "path": "/users/42", "body": "{\"name\": \"alice\"}", "mocked": true, "user": "42"}`))
+		So(w.Body.String(), ShouldEqual, `{"id":1,"tags":["a","42"],"path":"/users/42","body":"{\"name\": \"alice\"}","mocked":true,"user":"42"}`)
+		So(w.Header().Get("Content-Length"), ShouldEqual, fmt.Sprint(w.Body.Len()))
+	})
+
+	Convey("replace text response with delay", t, func() {
+		start := time.Now()
+		w := do("POST", "/text", "name=alice", "application/x-www-form-urlencoded")
+		So(w.Code, ShouldEqual, 200)
+		So(w.Body.String(), ShouldEqual, "test-api POST name=alice auth=Bearer token")
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+	})
+
+	Convey("respond 502 if patch fails", t, func() {
+		So(do("GET", "/broken", "", "").Code, ShouldEqual, 502)
+	})
+
+	Convey("record route and upstream in journal", t, func() {
+		RequestJournal.Clear()
+		do("POST", "/users/7", "", "")
+		entries := RequestJournal.Find(&JournalFilter{Path: "/users/7"})
+		So(entries, ShouldHaveLength, 1)
+		So(entries[0].Route, ShouldEqual, "POST /users/:id")
+		So(entries[0].Proxy, ShouldEqual, upstream.URL)
+		So(entries[0].Response.Code, ShouldEqual, 201)
+	})
+
+	Convey("check passthrough route", t, func() {
+		for _, cfg := range []string{
+			"routes:\n  - uri: /a\n    passthrough: {upstream: localhost}\n",
+			"routes:\n  - uri: /a\n    passthrough: {upstream: 'http://localhost'}\n    response: {code: 200}\n",
+			"routes:\n  - uri: /a\n    passthrough: {upstream: 'http://localhost', jsonPatch: [{op: merge, path: /a}]}\n",
+			"routes:\n  - uri: /a\n    passthrough: {upstream: 'http://localhost', replace: [{regex: '('}]}\n",
+		} {
+			s := NewHttpServer()
+			So(s.Load([]byte(cfg)), ShouldBeNil)
+			So(s.initRoutes(), ShouldNotBeNil)
+		}
+	})
+}
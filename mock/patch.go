@@ -0,0 +1,313 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JsonPatchOp is an operation of JSON Patch (RFC 6902)
+type JsonPatchOp struct {
+	Op    string      `yaml:"op" json:"op"` // add, remove, replace, move, copy or test
+	Path  string      `yaml:"path" json:"path"`
+	From  string      `yaml:"from,omitempty" json:"from,omitempty"` // source of move and copy
+	Value interface{} `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+func (op *JsonPatchOp) compile() error {
+	switch op.Op {
+	case "add", "remove", "replace", "test":
+	case "move", "copy":
+		if _, err := splitPointer(op.From); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid JSON patch op %s", op.Op)
+	}
+	_, err := splitPointer(op.Path)
+
+	return err
+}
+
+// mergePatch applies JSON merge patch (RFC 7386) to target, keys of ordered
+// target keep their order and new keys are appended in order of patch
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	if p, ok := patch.(*orderedMap); ok {
+		t, ok := target.(*orderedMap)
+		if !ok {
+			t = newOrderedMap()
+		}
+		for _, k := range p.keys {
+			if v := p.values[k]; v == nil {
+				t.delete(k)
+			} else {
+				t.set(k, mergePatch(t.values[k], v))
+			}
+		}
+		return t
+	}
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+
+	return t
+}
+
+// jsonPatch applies operations of JSON Patch (RFC 6902) to doc in order, and
+// returns the patched doc
+func jsonPatch(doc interface{}, ops []*JsonPatchOp) (interface{}, error) {
+	var err error
+	for _, op := range ops {
+		if doc, err = op.apply(doc); err != nil {
+			return nil, fmt.Errorf("JSON patch %s %s: %v", op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func (op *JsonPatchOp) apply(doc interface{}) (interface{}, error) {
+	path, err := splitPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return pointerAdd(doc, path, op.Value)
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "replace": // in place, so that key order is kept
+		if _, err := pointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		return pointerSet(doc, path, op.Value)
+	case "test":
+		v, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(v, op.Value) {
+			return nil, fmt.Errorf("value is %s", jsonString(v))
+		}
+		return doc, nil
+	}
+
+	// move or copy
+	from, err := splitPointer(op.From)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if op.Op == "move" {
+		doc, v, err = pointerRemove(doc, from)
+	} else {
+		v, err = pointerGet(doc, from)
+		v = deepCopy(v)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pointerAdd(doc, path, v)
+}
+
+// splitPointer splits JSON pointer (RFC 6901) into unescaped tokens
+func splitPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %s", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for idx, t := range tokens {
+		tokens[idx] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// arrayIndex returns index of token in array of size, "-" is size if end is
+// allowed
+func arrayIndex(token string, size int, end bool) (int, error) {
+	if token == "-" && end {
+		return size, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || idx > size || (idx == size && !end) || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %s", token)
+	}
+
+	return idx, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, exists := d[t]
+			if !exists {
+				return nil, fmt.Errorf("member %s does not exist", t)
+			}
+			doc = v
+		case *orderedMap:
+			v, exists := d.values[t]
+			if !exists {
+				return nil, fmt.Errorf("member %s does not exist", t)
+			}
+			doc = v
+		case []interface{}:
+			idx, err := arrayIndex(t, len(d), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = d[idx]
+		default:
+			return nil, fmt.Errorf("member %s does not exist", t)
+		}
+	}
+
+	return doc, nil
+}
+
+// pointerAdd adds value at path, and returns the modified doc
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = value
+		return doc, nil
+	case *orderedMap:
+		p.set(last, value)
+		return doc, nil
+	case []interface{}:
+		idx, err := arrayIndex(last, len(p), true)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p[:idx], append([]interface{}{value}, p[idx:]...)...)
+		return pointerSet(doc, path[:len(path)-1], p)
+	}
+
+	return nil, fmt.Errorf("parent of %s is not a container", last)
+}
+
+// pointerRemove removes value at path, and returns the modified doc and the
+// removed value
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	v, err := pointerGet(doc, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(path) == 0 {
+		return nil, v, nil
+	}
+	parent, _ := pointerGet(doc, path[:len(path)-1])
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		delete(p, last)
+		return doc, v, nil
+	case *orderedMap:
+		p.delete(last)
+		return doc, v, nil
+	case []interface{}:
+		idx, _ := arrayIndex(last, len(p), false)
+		p = append(p[:idx:idx], p[idx+1:]...)
+		doc, err := pointerSet(doc, path[:len(path)-1], p)
+		return doc, v, err
+	}
+
+	return nil, nil, fmt.Errorf("parent of %s is not a container", last)
+}
+
+// pointerSet replaces value at existing path, arrays are replaced as they
+// may be reallocated
+func pointerSet(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = value
+	case *orderedMap:
+		p.set(last, value)
+	case []interface{}:
+		idx, _ := arrayIndex(last, len(p), false)
+		p[idx] = value
+	}
+
+	return doc, nil
+}
+
+// jsonEqual reports whether JSON values are equal, numbers are compared by value
+func jsonEqual(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(normalizeJSON(a), normalizeJSON(b))
+}
+
+// normalizeJSON returns value decoded from JSON of v, so that values of
+// different Go types can be compared
+func normalizeJSON(v interface{}) interface{} {
+	data, err := MarshalJSON(v)
+	if err != nil {
+		return v
+	}
+	var n interface{}
+	if err := json.Unmarshal(data, &n); err != nil {
+		return v
+	}
+
+	return n
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = deepCopy(item)
+		}
+		return m
+	case *orderedMap:
+		m := newOrderedMap()
+		for _, k := range v.keys {
+			m.set(k, deepCopy(v.values[k]))
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for idx, item := range v {
+			s[idx] = deepCopy(item)
+		}
+		return s
+	}
+
+	return v
+}
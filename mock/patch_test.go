@@ -0,0 +1,103 @@
+package mock
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func decodeJSON(s string) interface{} {
+	var v interface{}
+	json.Unmarshal([]byte(s), &v)
+	return v
+}
+
+func TestMergePatch(t *testing.T) {
+	Convey("merge patch", t, func() {
+		cases := [][3]string{
+			{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+			{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+			{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+			{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+			{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+			{`["a","b"]`, `{"a":"b"}`, `{"a":"b"}`},
+			{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		}
+		for _, c := range cases {
+			So(mergePatch(decodeJSON(c[0]), decodeJSON(c[1])), ShouldResemble, decodeJSON(c[2]))
+		}
+	})
+
+	Convey("keep key order of ordered target", t, func() {
+		target, _ := decodeOrderedJSON([]byte(`{"z":1,"b":{"y":1,"x":2},"a":1.50}`))
+		patch, _ := decodeOrderedJSON([]byte(`{"b":{"y":null,"w":3},"z":null,"d":4,"c":5}`))
+		data, err := MarshalJSON(mergePatch(target, patch))
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"b":{"x":2,"w":3},"a":1.50,"d":4,"c":5}`)
+	})
+}
+
+func TestJSONPatch(t *testing.T) {
+	patch := func(doc string, ops ...*JsonPatchOp) (interface{}, error) {
+		for _, op := range ops {
+			if err := op.compile(); err != nil {
+				return nil, err
+			}
+		}
+		return jsonPatch(decodeJSON(doc), ops)
+	}
+
+	Convey("apply operations", t, func() {
+		doc, err := patch(`{"foo":["bar","baz"],"a/b":1,"x":{"y":1}}`,
+			&JsonPatchOp{Op: "add", Path: "/foo/1", Value: "qux"},
+			&JsonPatchOp{Op: "add", Path: "/foo/-", Value: "end"},
+			&JsonPatchOp{Op: "remove", Path: "/foo/0"},
+			&JsonPatchOp{Op: "replace", Path: "/a~1b", Value: 2},
+			&JsonPatchOp{Op: "copy", From: "/x", Path: "/z"},
+			&JsonPatchOp{Op: "move", From: "/x/y", Path: "/x/w"},
+			&JsonPatchOp{Op: "test", Path: "/z", Value: map[string]interface{}{"y": 1}},
+		)
+		So(err, ShouldBeNil)
+		So(normalizeJSON(doc), ShouldResemble, decodeJSON(`{"foo":["qux","baz","end"],"a/b":2,"x":{"w":1},"z":{"y":1}}`))
+	})
+
+	Convey("keep key order of ordered doc", t, func() {
+		doc, _ := decodeOrderedJSON([]byte(`{"z":{"y":1},"b":[1,2],"a":1.50}`))
+		ops := []*JsonPatchOp{
+			{Op: "replace", Path: "/z", Value: 2},
+			{Op: "copy", From: "/b", Path: "/c"},
+			{Op: "remove", Path: "/b/0"},
+			{Op: "add", Path: "/d", Value: true},
+		}
+		for _, op := range ops {
+			So(op.compile(), ShouldBeNil)
+		}
+		doc, err := jsonPatch(doc, ops)
+		So(err, ShouldBeNil)
+		data, err := MarshalJSON(doc)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"z":2,"b":[2],"a":1.50,"c":[1,2],"d":true}`)
+	})
+
+	Convey("replace whole document", t, func() {
+		doc, err := patch(`{"a":1}`, &JsonPatchOp{Op: "replace", Path: "", Value: []interface{}{1}})
+		So(err, ShouldBeNil)
+		So(normalizeJSON(doc), ShouldResemble, decodeJSON(`[1]`))
+	})
+
+	Convey("report errors", t, func() {
+		_, err := patch(`{"a":1}`, &JsonPatchOp{Op: "test", Path: "/a", Value: 2})
+		So(err, ShouldNotBeNil)
+		_, err = patch(`{"a":1}`, &JsonPatchOp{Op: "remove", Path: "/b"})
+		So(err, ShouldNotBeNil)
+		_, err = patch(`{"a":[1]}`, &JsonPatchOp{Op: "add", Path: "/a/2", Value: 1})
+		So(err, ShouldNotBeNil)
+		_, err = patch(`{"a":[1]}`, &JsonPatchOp{Op: "replace", Path: "/a/01", Value: 1})
+		So(err, ShouldNotBeNil)
+		_, err = patch(`{}`, &JsonPatchOp{Op: "merge", Path: "/a"})
+		So(err, ShouldNotBeNil)
+		_, err = patch(`{}`, &JsonPatchOp{Op: "add", Path: "a"})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,188 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gookit/slog"
+	"gopkg.in/yaml.v3"
+)
+
+// proxy fallthrough example, requests matching no route are forwarded to
+// upstream of the longest matching prefix
+//
+// proxy:
+//   - upstream: http://127.0.0.1:8080 # prefix defaults to "/"
+//   - prefix: /billing
+//     upstream: https://billing.example.com
+//     timeout: 3000 # in milliseconds, 504 on timeout
+//     headers: # set on request, removed if empty
+//       Authorization: Bearer token
+//       Cookie: ""
+//     responseHeaders: # set on response, removed if empty
+//       Proxied-By: moko
+
+// HttpProxy forwards requests of prefix to upstream
+type HttpProxy struct {
+	Prefix          string            `yaml:"prefix,omitempty"` // path prefix, default "/"
+	Upstream        string            `yaml:"upstream"`
+	Timeout         int               `yaml:"timeout,omitempty"`
+	Headers         map[string]string `yaml:"headers,omitempty"`
+	ResponseHeaders map[string]string `yaml:"responseHeaders,omitempty"`
+
+	file string // config file and line of proxy, for error message
+	line int
+}
+
+func (p *HttpProxy) UnmarshalYAML(node *yaml.Node) error {
+	type plain HttpProxy
+	if err := node.Decode((*plain)(p)); err != nil {
+		return err
+	}
+	p.line = node.Line
+
+	return nil
+}
+
+func (p *HttpProxy) normalize() {
+	if p != nil && p.Prefix == "" {
+		p.Prefix = "/"
+	}
+}
+
+// match reports whether path is under prefix of proxy
+func (p *HttpProxy) match(path string) bool {
+	prefix := strings.TrimSuffix(p.Prefix, "/")
+
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// handler returns reverse proxy of upstream
+func (p *HttpProxy) handler() (http.Handler, error) {
+	if !strings.HasPrefix(p.Prefix, "/") {
+		return nil, fmt.Errorf("invalid proxy prefix %s", p.Prefix)
+	}
+	proxy, err := newReverseProxy(p.Upstream, p.Timeout, p.Headers)
+	if err != nil {
+		return nil, err
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		setHeaders(resp.Header, p.ResponseHeaders)
+		return nil
+	}
+
+	return forward(proxy, p.Upstream, p.Timeout), nil
+}
+
+// newReverseProxy returns reverse proxy of upstream, headers are set on
+// request or removed if empty
+func newReverseProxy(upstream string, timeout int, headers map[string]string) (*httputil.ReverseProxy, error) {
+	if timeout < 0 {
+		return nil, fmt.Errorf("invalid proxy timeout %d", timeout)
+	}
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid proxy upstream %s", upstream)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+		setHeaders(r.Header, headers)
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		slog.Errorf("proxy %s %s to %s error: %v", r.Method, r.URL.Path, upstream, err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	return proxy, nil
+}
+
+// forward serves requests with proxy in timeout milliseconds, and records
+// upstream into journal
+func forward(proxy *httputil.ReverseProxy, upstream string, timeout int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if e := journalEntryFromContext(r.Context()); e != nil {
+			e.Proxy = upstream
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Millisecond)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+// setHeaders sets headers, or removes them if value is empty
+func setHeaders(h http.Header, headers map[string]string) {
+	for k, v := range headers {
+		if v == "" {
+			h.Del(k)
+			continue
+		}
+		h.Set(k, v)
+	}
+}
+
+// proxyHandler forwards requests to the proxy of the longest matching prefix,
+// or serves them with fallback if none matches. All proxy errors are returned.
+func proxyHandler(proxies []*HttpProxy, fallback http.Handler) (http.Handler, error) {
+	if len(proxies) == 0 {
+		return fallback, nil
+	}
+	for _, p := range proxies {
+		if p == nil {
+			return nil, errors.New("proxy is empty")
+		}
+	}
+
+	var errs configErrors
+	seen := map[string]bool{}
+	sorted := append([]*HttpProxy{}, proxies...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i].Prefix) > len(sorted[j].Prefix) })
+	handlers := make([]http.Handler, len(sorted))
+	for idx, p := range sorted {
+		if seen[p.Prefix] {
+			errs = append(errs, newConfigError(p.file, p.line, "duplicated proxy prefix %s", p.Prefix))
+			continue
+		}
+		seen[p.Prefix] = true
+		h, err := p.handler()
+		if err != nil {
+			errs = append(errs, newConfigError(p.file, p.line, "%v", err))
+			continue
+		}
+		slog.Infof("add proxy: %s => %s", p.Prefix, p.Upstream)
+		handlers[idx] = h
+	}
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for idx, p := range sorted {
+			if p.match(r.URL.Path) {
+				handlers[idx].ServeHTTP(w, r)
+				return
+			}
+		}
+		fallback.ServeHTTP(w, r)
+	}), nil
+}
@@ -0,0 +1,146 @@
+package mock
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProxy(t *testing.T) {
+	upstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/slow") {
+				time.Sleep(200 * time.Millisecond)
+			}
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Server-Header", "upstream")
+			fmt.Fprintf(w, "%s %s %s auth=%s cookie=%s body=%s", name, r.Method, r.URL.RequestURI(),
+				r.Header.Get("Authorization"), r.Header.Get("Cookie"), body)
+		}))
+	}
+	api, billing := upstream("api"), upstream("billing")
+	defer api.Close()
+	defer billing.Close()
+
+	s := NewHttpServer()
+	err := s.Load([]byte(fmt.Sprintf(`
+default:
+  code: 418
+proxy:
+  - prefix: /api
+    upstream: %s
+    timeout: 100
+    headers:
+      Authorization: Bearer token
+      Cookie: ""
+    responseHeaders:
+      Server-Header: ""
+      Proxied-By: moko
+  - prefix: /api/billing/
+    upstream: %s
+hosts:
+  - host: partner.test
+    proxy:
+      - upstream: %s
+    routes: []
+routes:
+  - uri: /api/hello
+    response:
+      body: mocked
+  - uri: /api/lang
+    request:
+      headers:
+        X-Lang: fr
+    response:
+      body: bonjour
+`, api.URL, billing.URL, billing.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	do := func(method string, uri string, body string, headers map[string]string) *http.Response {
+		req := httptest.NewRequest(method, uri, strings.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		journalHandler(RequestJournal, s).ServeHTTP(w, req)
+		return w.Result()
+	}
+	read := func(resp *http.Response) string {
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	Convey("serve matched routes", t, func() {
+		So(read(do("GET", "/api/hello", "", nil)), ShouldEqual, "mocked")
+	})
+
+	Convey("forward unmatched requests with method, headers and body", t, func() {
+		resp := do("PUT", "/api/users/1?debug=1", "data", map[string]string{"Cookie": "a=b"})
+		So(resp.StatusCode, ShouldEqual, 200)
+		So(read(resp), ShouldEqual, "api PUT /api/users/1?debug=1 auth=Bearer token cookie= body=data")
+		So(resp.Header.Get("Proxied-By"), ShouldEqual, "moko")
+		So(resp.Header.Get("Server-Header"), ShouldBeEmpty)
+	})
+
+	Convey("forward requests of other methods and unmatched request matchers", t, func() {
+		So(read(do("POST", "/api/hello", "", nil)), ShouldStartWith, "api POST /api/hello")
+		So(read(do("GET", "/api/lang", "", nil)), ShouldStartWith, "api GET /api/lang")
+		So(read(do("GET", "/api/lang", "", map[string]string{"X-Lang": "fr"})), ShouldEqual, "bonjour")
+	})
+
+	Convey("forward to proxy of the longest prefix", t, func() {
+		So(read(do("GET", "/api/billing/invoices", "", nil)), ShouldStartWith, "billing GET")
+		So(read(do("GET", "/apix", "", nil)), ShouldBeEmpty)
+	})
+
+	Convey("serve default response if no prefix matches", t, func() {
+		So(do("GET", "/other", "", nil).StatusCode, ShouldEqual, 418)
+	})
+
+	Convey("forward by proxy of host", t, func() {
+		resp := do("GET", "http://partner.test/api/hello", "", nil)
+		So(read(resp), ShouldStartWith, "billing GET /api/hello")
+	})
+
+	Convey("respond 504 on upstream timeout", t, func() {
+		So(do("GET", "/api/slow", "", nil).StatusCode, ShouldEqual, 504)
+	})
+
+	Convey("respond 502 on upstream error", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("proxy:\n  - upstream: http://127.0.0.1:1\n")), ShouldBeNil)
+		So(s.initRoutes(), ShouldBeNil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		So(w.Code, ShouldEqual, 502)
+	})
+
+	Convey("record upstream in journal", t, func() {
+		RequestJournal.Clear()
+		do("GET", "/api/users", "", nil)
+		entries := RequestJournal.Find(&JournalFilter{Path: "/api/users"})
+		So(entries, ShouldHaveLength, 1)
+		So(entries[0].Proxy, ShouldEqual, api.URL)
+		So(entries[0].Route, ShouldBeEmpty)
+	})
+
+	Convey("check proxies", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("proxy:\n  - upstream: localhost\n  - prefix: api\n    upstream: http://localhost\n  - upstream: http://localhost\n")), ShouldBeNil)
+		err := s.initRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "line 2: invalid proxy upstream localhost")
+		So(err.Error(), ShouldContainSubstring, "line 3: invalid proxy prefix api")
+		So(err.Error(), ShouldContainSubstring, "line 5: duplicated proxy prefix /")
+	})
+}
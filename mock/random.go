@@ -0,0 +1,39 @@
+package mock
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// random is the random source of mock data, seed it by SetSeed to reproduce
+// random responses in tests
+var random = &lockedRand{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// SetSeed seeds the random source of mock data
+func SetSeed(seed int64) {
+	random.mu.Lock()
+	defer random.mu.Unlock()
+
+	random.r = rand.New(rand.NewSource(seed))
+}
+
+// lockedRand is a rand.Rand safe for concurrent use
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (r *lockedRand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.r.Intn(n)
+}
+
+func (r *lockedRand) Float64() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.r.Float64()
+}
@@ -0,0 +1,314 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gookit/slog"
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+// http record mode example, requests are forwarded to upstream, and recorded
+// routes are written to output on exit
+//
+// record:
+//   upstream: http://127.0.0.1:8080
+//   output: recorded-http-mock.yml
+//   dedup: true  # keep only the first response of the same method and uri
+//   params: true # turn volatile path segments (numbers, uuids, hashes) into :param
+
+// headers not written to recorded response
+var skippedRecordHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Date":              true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+}
+
+// volatile path segment: number, uuid or hex hash
+var volatileSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}(-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+type HttpRecorder struct {
+	Upstream string `yaml:"upstream"`
+	Output   string `yaml:"output"`
+	Dedup    bool   `yaml:"dedup"`
+	Params   bool   `yaml:"params"`
+
+	proxy  *httputil.ReverseProxy
+	mu     sync.Mutex
+	routes []*HttpRoute
+}
+
+func (rec *HttpRecorder) init() error {
+	if rec.Output == "" {
+		return errors.New("record output is not set")
+	}
+	target, err := url.Parse(rec.Upstream)
+	if err != nil {
+		return err
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return fmt.Errorf("invalid record upstream %s", rec.Upstream)
+	}
+
+	rec.proxy = httputil.NewSingleHostReverseProxy(target)
+	director := rec.proxy.Director
+	rec.proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+		// let transport handle compression, so that plain body is recorded
+		r.Header.Del("Accept-Encoding")
+	}
+	rec.proxy.ModifyResponse = rec.add
+
+	return nil
+}
+
+func (rec *HttpRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.proxy.ServeHTTP(w, r)
+}
+
+// add records upstream response as a route
+func (rec *HttpRecorder) add(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	// bodies and headers are escaped, so that they are not rendered as templates on replay
+	response := &HttpResponse{Code: resp.StatusCode, Headers: map[string]string{}}
+	if utf8.Valid(data) {
+		response.Body = escapeTemplate(string(data))
+	} else if len(data) > 0 { // binary body is kept as is
+		response.BodyBase64 = base64.StdEncoding.EncodeToString(data)
+	}
+	isJSON := false
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		if body, err := decodeOrderedJSON(data); err == nil {
+			switch body.(type) {
+			case *orderedMap, []interface{}: // json body is set by mock
+				response.Body = escapeTemplates(body)
+				isJSON = true
+			}
+		}
+	}
+	for k := range resp.Header {
+		if skippedRecordHeaders[k] || (isJSON && k == "Content-Type") {
+			continue
+		}
+		response.Headers[k] = escapeTemplate(resp.Header.Get(k))
+	}
+	if len(response.Headers) == 0 {
+		response.Headers = nil
+	}
+
+	req := resp.Request
+	slog.Infof("record HTTP API: %s %s %d", req.Method, req.URL.Path, resp.StatusCode)
+	rec.mu.Lock()
+	rec.routes = append(rec.routes, &HttpRoute{Uri: req.URL.Path, Method: req.Method, Response: response})
+	rec.mu.Unlock()
+
+	return nil
+}
+
+// Routes returns recorded routes, in which volatile segments are replaced and
+// duplicated routes are removed if configured
+func (rec *HttpRecorder) Routes() []*HttpRoute {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	methods := make([]string, len(rec.routes))
+	uris := make([]string, len(rec.routes))
+	for idx, r := range rec.routes {
+		methods[idx], uris[idx] = r.Method, r.Uri
+	}
+	if rec.Params {
+		uris = paramURIs(methods, uris)
+	}
+	routes := []*HttpRoute{}
+	seen := map[string]bool{}
+	for idx, r := range rec.routes {
+		route := *r
+		route.Uri = uris[idx]
+		key := route.Method + " " + route.Uri
+		if rec.Dedup && seen[key] {
+			continue
+		}
+		seen[key] = true
+		routes = append(routes, &route)
+	}
+
+	return routes
+}
+
+// Save writes recorded routes to output file
+func (rec *HttpRecorder) Save() error {
+	data, err := yaml.Marshal(map[string]interface{}{"routes": rec.Routes()})
+	if err != nil {
+		return err
+	}
+	slog.Infof("write recorded HTTP routes to %s", rec.Output)
+
+	return os.WriteFile(rec.Output, data, 0644)
+}
+
+// paramURIs replaces volatile path segments of uris with :param1, :param2...,
+// unless a static segment of the same method is at the same position under the
+// same prefix, which would conflict in router, eg. /users/123 and /users/me
+func paramURIs(methods []string, uris []string) []string {
+	segs := make([][]string, len(uris))
+	out := make([][]string, len(uris))
+	params := make([]int, len(uris))
+	for idx, uri := range uris {
+		segs[idx] = strings.Split(uri, "/")
+	}
+	prefix := func(idx int) string {
+		return methods[idx] + " " + strings.Join(out[idx], "/")
+	}
+	for depth := 0; ; depth++ {
+		static := map[string]bool{} // prefixes with static segment at depth
+		more := false
+		for idx := range segs {
+			if depth < len(segs[idx]) {
+				more = true
+				if !volatileSegment.MatchString(segs[idx][depth]) {
+					static[prefix(idx)] = true
+				}
+			}
+		}
+		if !more {
+			break
+		}
+		for idx := range segs {
+			if depth >= len(segs[idx]) {
+				continue
+			}
+			seg := segs[idx][depth]
+			if volatileSegment.MatchString(seg) && !static[prefix(idx)] {
+				params[idx]++
+				seg = fmt.Sprintf(":param%d", params[idx])
+			}
+			out[idx] = append(out[idx], seg)
+		}
+	}
+
+	result := make([]string, len(uris))
+	for idx := range out {
+		result[idx] = strings.Join(out[idx], "/")
+	}
+
+	return result
+}
+
+// escapeTemplates escapes template delimiters in strings and keys of v
+func escapeTemplates(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return escapeTemplate(v)
+	case *orderedMap:
+		m := newOrderedMap()
+		for _, k := range v.keys {
+			m.set(escapeTemplate(k), escapeTemplates(v.values[k]))
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for idx, item := range v {
+			s[idx] = escapeTemplates(item)
+		}
+		return s
+	}
+
+	return v
+}
+
+// dns record mode example, all queries are forwarded to parent DNS, and
+// answered A records are written to output on exit
+//
+// record:
+//   output: recorded-dns-mock.yml
+
+type DNSRecorder struct {
+	Output string `yaml:"output"`
+
+	mu     sync.Mutex
+	routes []*Record
+	index  map[string]*Record // {fqdn: record}
+}
+
+func (rec *DNSRecorder) init() error {
+	if rec.Output == "" {
+		return errors.New("record output is not set")
+	}
+	rec.index = map[string]*Record{}
+
+	return nil
+}
+
+// Add records A answers of m, IPs of the same FQDN are merged
+func (rec *DNSRecorder) Add(m *dns.Msg) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	for _, rr := range m.Answer {
+		a, ok := rr.(*dns.A)
+		if !ok {
+			slog.Debugf("skip recording unsupported DNS answer: %s", rr)
+			continue
+		}
+		r, exists := rec.index[a.Hdr.Name]
+		if !exists {
+			r = &Record{Rrtype: "A", Fqdn: a.Hdr.Name, Ttl: a.Hdr.Ttl}
+			rec.index[a.Hdr.Name] = r
+			rec.routes = append(rec.routes, r)
+			slog.Infof("record DNS: A %s", a.Hdr.Name)
+		}
+		ip := a.A.String()
+		ips := strings.Split(r.Ip, ",")
+		if r.Ip == "" {
+			ips = nil
+		}
+		if !containsString(ips, ip) {
+			r.Ip = strings.Join(append(ips, ip), ",")
+		}
+	}
+}
+
+// Save writes recorded records to output file
+func (rec *DNSRecorder) Save() error {
+	rec.mu.Lock()
+	data, err := yaml.Marshal(map[string]interface{}{"routes": rec.routes})
+	rec.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	slog.Infof("write recorded DNS records to %s", rec.Output)
+
+	return os.WriteFile(rec.Output, data, 0644)
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,157 @@
+package mock
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPRecord(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/text" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Trace-Id", "12345")
+			fmt.Fprint(w, "hello world")
+			return
+		}
+		if r.URL.Path == "/bin" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0xff, 0x00, 0x01})
+			return
+		}
+		if r.URL.Path == "/tpl" {
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Header().Set("X-Tpl", "${x}")
+			fmt.Fprint(w, "var a = `${b}` + {{c}} + ${{d}}")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/users/") {
+			fmt.Fprintf(w, `{"path":"%s","id":12345678901234567890,"n":1000000,"t":"{{.x}}"}`, r.URL.Path)
+			return
+		}
+		w.WriteHeader(201)
+		fmt.Fprintf(w, `{"path":"%s","ok":true}`, r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	output := filepath.Join(t.TempDir(), "recorded.yml")
+	rec := &HttpRecorder{Upstream: upstream.URL, Output: output, Dedup: true, Params: true}
+	if err := rec.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	doHTTPRequest := func(method string, uri string) *http.Response {
+		req, _ := http.NewRequest(method, uri, nil)
+		w := httptest.NewRecorder()
+		rec.ServeHTTP(w, req)
+
+		return w.Result()
+	}
+
+	Convey("forward requests to upstream", t, func() {
+		resp := doHTTPRequest("GET", "/text")
+		So(resp.StatusCode, ShouldEqual, 200)
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "hello world")
+		resp = doHTTPRequest("POST", "/users/123")
+		So(resp.StatusCode, ShouldEqual, 201)
+		doHTTPRequest("POST", "/users/456")
+		doHTTPRequest("GET", "/users/9b2e5d4c-3a8f-4f6e-9d2b-1c7a8e6f5b40/orders")
+	})
+
+	Convey("param and dedup recorded routes", t, func() {
+		uris := getUris(rec.Routes())
+		So(uris, ShouldResemble, []string{"GET /text", "POST /users/:param1", "GET /users/:param1/orders"})
+		body, _ := MarshalJSON(rec.Routes()[1].Response.Body)
+		So(string(body), ShouldEqual, `{"path":"/users/123","ok":true}`)
+	})
+
+	Convey("save recorded routes as mock cfg", t, func() {
+		So(rec.Save(), ShouldBeNil)
+		s := NewHttpServer()
+		So(s.loadConfig(output), ShouldBeNil)
+		So(getUris(s.Routes), ShouldResemble, []string{"GET /text", "POST /users/:param1", "GET /users/:param1/orders"})
+		So(s.Routes[0].Response.Headers, ShouldResemble, map[string]string{"Content-Type": "text/plain", "Trace-Id": "12345"})
+		So(s.Routes[1].Response.Code, ShouldEqual, 201)
+		So(s.Routes[1].Response.Headers, ShouldBeNil)
+	})
+
+	Convey("param volatile segments", t, func() {
+		So(paramURIs([]string{"GET", "GET"}, []string{"/users/me", "/users/42/commits/0123456789abcdef0123"}),
+			ShouldResemble, []string{"/users/me", "/users/42/commits/:param1"})
+		So(paramURIs([]string{"GET", "POST", "GET"}, []string{"/users/42/commits/0123456789abcdef0123", "/users/me", "/users/7/commits/0123456789abcdef0124"}),
+			ShouldResemble, []string{"/users/:param1/commits/:param2", "/users/me", "/users/:param1/commits/:param2"})
+	})
+
+	Convey("save routes loadable with static siblings and templates", t, func() {
+		rec := &HttpRecorder{Upstream: upstream.URL, Output: output, Params: true}
+		So(rec.init(), ShouldBeNil)
+		rec.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/123", nil))
+		rec.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/me", nil))
+		rec.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/tpl", nil))
+		So(getUris(rec.Routes()), ShouldResemble, []string{"GET /users/123", "GET /users/me", "GET /tpl"})
+		So(rec.Save(), ShouldBeNil)
+
+		s := NewHttpServer()
+		So(s.loadConfig(output), ShouldBeNil)
+		So(s.initRoutes(), ShouldBeNil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/tpl", nil))
+		So(w.Body.String(), ShouldEqual, "var a = `${b}` + {{c}} + ${{d}}")
+		So(w.Header().Get("X-Tpl"), ShouldEqual, "${x}")
+		w = httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/users/123", nil))
+		So(w.Body.String(), ShouldEqual, `{"path":"/users/123","id":12345678901234567890,"n":1000000,"t":"{{.x}}"}`)
+	})
+
+	Convey("save binary body in base64", t, func() {
+		rec := &HttpRecorder{Upstream: upstream.URL, Output: output}
+		So(rec.init(), ShouldBeNil)
+		rec.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/bin", nil))
+		So(rec.Routes()[0].Response.Body, ShouldBeNil)
+		So(rec.Routes()[0].Response.BodyBase64, ShouldEqual, "/wAB")
+		So(rec.Save(), ShouldBeNil)
+
+		s := NewHttpServer()
+		So(s.loadConfig(output), ShouldBeNil)
+		So(s.initRoutes(), ShouldBeNil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/bin", nil))
+		So(w.Body.Bytes(), ShouldResemble, []byte{0xff, 0x00, 0x01})
+	})
+}
+
+func TestDNSRecord(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "recorded.yml")
+	rec := &DNSRecorder{Output: output}
+	if err := rec.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	newA := func(name string, ip string) dns.RR {
+		return &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60}, A: net.ParseIP(ip)}
+	}
+
+	Convey("merge and save answered A records", t, func() {
+		rec.Add(&dns.Msg{Answer: []dns.RR{newA("www.example.com.", "10.0.0.1"), newA("www.example.com.", "10.0.0.2")}})
+		rec.Add(&dns.Msg{Answer: []dns.RR{newA("www.example.com.", "10.0.0.1"), newA("api.example.com.", "10.0.0.3")}})
+		So(rec.Save(), ShouldBeNil)
+
+		s := NewDNSServer()
+		So(s.loadConfig(output), ShouldBeNil)
+		So(len(s.Routes), ShouldEqual, 2)
+		So(*s.Routes[0], ShouldResemble, Record{Rrtype: "A", Fqdn: "www.example.com.", Ip: "10.0.0.1,10.0.0.2", Ttl: 60, file: output, line: 2})
+		So(*s.Routes[1], ShouldResemble, Record{Rrtype: "A", Fqdn: "api.example.com.", Ip: "10.0.0.3", Ttl: 60, file: output, line: 6})
+		_, err := newDNSMap(s.Routes)
+		So(err, ShouldBeNil)
+	})
+}
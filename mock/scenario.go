@@ -0,0 +1,138 @@
+package mock
+
+import (
+	"fmt"
+	"sync"
+)
+
+// scenarios example
+//
+// scenarios: # initial states, default "started"
+//   orders: empty
+// routes:
+//   - uri: /orders
+//     method: POST
+//     scenario:
+//       name: orders
+//       newState: created # move to state after route served
+//   - uri: /orders
+//     scenario:
+//       name: orders
+//       state: created # route matches only in state
+//     response:
+//       body: [{id: 1}]
+//   - uri: /orders
+//     response:
+//       body: []
+
+const defaultScenarioState = "started"
+
+// HttpScenario binds route to a named scenario state
+type HttpScenario struct {
+	Name     string `yaml:"name"`
+	State    string `yaml:"state,omitempty"`    // route matches only in state, any state if empty
+	NewState string `yaml:"newState,omitempty"` // scenario moves to state after route matched
+}
+
+func (c *HttpScenario) compile() error {
+	if c.Name == "" {
+		return fmt.Errorf("scenario name is not set")
+	}
+
+	return nil
+}
+
+// scenarioStates keeps current states of scenarios
+type scenarioStates struct {
+	mu      sync.Mutex
+	initial map[string]string
+	states  map[string]string
+}
+
+func newScenarioStates(initial map[string]string) *scenarioStates {
+	states := &scenarioStates{initial: map[string]string{}, states: map[string]string{}}
+	for name, state := range initial {
+		states.initial[name] = state
+	}
+
+	return states
+}
+
+// add adds scenario name with default initial state if not added
+func (s *scenarioStates) add(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.initial[name]; !exists {
+		s.initial[name] = defaultScenarioState
+	}
+}
+
+func (s *scenarioStates) state(name string) string {
+	if state, exists := s.states[name]; exists {
+		return state
+	}
+
+	return s.initial[name]
+}
+
+// enter reports whether scenario of route is in required state, and moves it
+// to the new state if so. Nil scenario always enters.
+func (s *scenarioStates) enter(c *HttpScenario) bool {
+	if c == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c.State != "" && s.state(c.Name) != c.State {
+		return false
+	}
+	if c.NewState != "" {
+		s.states[c.Name] = c.NewState
+	}
+
+	return true
+}
+
+// list returns {name: current state} of all scenarios
+func (s *scenarioStates) list() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := map[string]string{}
+	for name := range s.initial {
+		states[name] = s.state(name)
+	}
+
+	return states
+}
+
+func (s *scenarioStates) set(name string, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.initial[name]; !exists {
+		return fmt.Errorf("scenario %s does not exist", name)
+	}
+	s.states[name] = state
+
+	return nil
+}
+
+// reset resets scenario to initial state, or all scenarios if name is empty
+func (s *scenarioStates) reset(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == "" {
+		s.states = map[string]string{}
+		return nil
+	}
+	if _, exists := s.initial[name]; !exists {
+		return fmt.Errorf("scenario %s does not exist", name)
+	}
+	delete(s.states, name)
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package mock
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScenarios(t *testing.T) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+scenarios:
+  orders: empty
+routes:
+  - uri: /orders
+    method: POST
+    scenario:
+      name: orders
+      state: empty
+      newState: created
+    response:
+      code: 201
+  - uri: /orders
+    method: POST
+    response:
+      code: 409
+  - uri: /orders
+    scenario:
+      name: orders
+      state: created
+    response:
+      body: [{id: 1}]
+  - uri: /orders
+    response:
+      body: []
+  - uri: /orders
+    method: DELETE
+    scenario:
+      name: cleanup
+      newState: done
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	doRequest := func(method string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, "/orders", nil))
+		body, _ := io.ReadAll(w.Result().Body)
+		return w.Code, string(body)
+	}
+
+	Convey("match routes by scenario state", t, func() {
+		_, body := doRequest("GET")
+		So(body, ShouldEqual, "[]")
+		code, _ := doRequest("POST")
+		So(code, ShouldEqual, 201)
+		_, body = doRequest("GET")
+		So(body, ShouldEqual, `[{"id":1}]`)
+		code, _ = doRequest("POST")
+		So(code, ShouldEqual, 409)
+	})
+
+	Convey("list, set and reset scenarios", t, func() {
+		So(s.ListScenarios(), ShouldResemble, map[string]string{"orders": "created", "cleanup": "started"})
+		doRequest("DELETE")
+		So(s.ListScenarios()["cleanup"], ShouldEqual, "done")
+
+		So(s.ResetScenarios("orders"), ShouldBeNil)
+		So(s.ListScenarios(), ShouldResemble, map[string]string{"orders": "empty", "cleanup": "done"})
+		So(s.SetScenario("orders", "created"), ShouldBeNil)
+		_, body := doRequest("GET")
+		So(body, ShouldEqual, `[{"id":1}]`)
+		So(s.SetScenario("unknown", "created"), ShouldNotBeNil)
+		So(s.ResetScenarios(""), ShouldBeNil)
+		So(s.ListScenarios(), ShouldResemble, map[string]string{"orders": "empty", "cleanup": "started"})
+	})
+
+	Convey("reset scenarios on reload", t, func() {
+		doRequest("POST")
+		So(s.ResetRoutes(), ShouldBeNil)
+		So(s.ListScenarios()["orders"], ShouldEqual, "empty")
+	})
+
+	Convey("report scenario without name", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /orders\n    scenario:\n      state: created\n")), ShouldBeNil)
+		err := s.initRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "line 2: scenario name is not set")
+	})
+}
@@ -0,0 +1,134 @@
+package mock
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// sequenced responses example
+//
+// routes:
+//   - uri: /job
+//     sequence:
+//       loop: false # repeat the last response after all served, or start over if true
+//       key: header:X-Test-Id # optional, counters are kept per header, cookie, query value or remote ip
+//       responses:
+//         - code: 202
+//         - code: 202
+//         - body: done
+
+// HttpSequence serves responses in order on successive calls
+type HttpSequence struct {
+	Responses []*HttpResponse `yaml:"responses"`
+	Loop      bool            `yaml:"loop,omitempty"`
+	Key       string          `yaml:"key,omitempty"` // header:<name>, cookie:<name>, query:<name> or remote
+
+	counters *sequenceCounters // shared by copies of sequence
+}
+
+type sequenceCounters struct {
+	mu    sync.Mutex
+	calls map[string]int // {client key: calls}
+}
+
+// compile checks sequence
+func (q *HttpSequence) compile() error {
+	if len(q.Responses) == 0 {
+		return fmt.Errorf("sequence responses are empty")
+	}
+	for idx, resp := range q.Responses {
+		if resp == nil {
+			return fmt.Errorf("sequence response %d is empty", idx)
+		}
+	}
+	kind, name, _ := strings.Cut(q.Key, ":")
+	switch {
+	case q.Key == "", q.Key == "remote":
+	case (kind == "header" || kind == "cookie" || kind == "query") && name != "":
+	default:
+		return fmt.Errorf("invalid sequence key %s", q.Key)
+	}
+	if q.counters == nil {
+		q.counters = &sequenceCounters{}
+	}
+
+	return nil
+}
+
+// clone returns a copy of sequence sharing counters
+func (q *HttpSequence) clone() *HttpSequence {
+	if q == nil {
+		return nil
+	}
+
+	return &HttpSequence{Responses: cloneResponses(q.Responses), Loop: q.Loop, Key: q.Key, counters: q.counters}
+}
+
+func (q *HttpSequence) normalize() {
+	for _, resp := range q.Responses {
+		resp.normalize()
+	}
+}
+
+// clientKey returns key of request client, empty if sequence is not keyed
+func (q *HttpSequence) clientKey(r *http.Request) string {
+	kind, name, _ := strings.Cut(q.Key, ":")
+	switch kind {
+	case "header":
+		return r.Header.Get(name)
+	case "cookie":
+		if c, err := r.Cookie(name); err == nil {
+			return c.Value
+		}
+	case "query":
+		return r.URL.Query().Get(name)
+	case "remote":
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+
+	return ""
+}
+
+// next returns index of the response to serve for client key
+func (q *HttpSequence) next(key string) int {
+	c := q.counters
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.calls == nil {
+		c.calls = map[string]int{}
+	}
+	calls := c.calls[key]
+	c.calls[key]++
+	if q.Loop {
+		return calls % len(q.Responses)
+	}
+	if calls >= len(q.Responses) {
+		return len(q.Responses) - 1
+	}
+
+	return calls
+}
+
+// reset resets counter of client key, or all counters if key is empty
+func (q *HttpSequence) reset(key string) {
+	c := q.counters
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key == "" {
+		c.calls = nil
+		return
+	}
+	delete(c.calls, key)
+}
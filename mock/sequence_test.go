@@ -0,0 +1,106 @@
+package mock
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSequence(t *testing.T) {
+	responses := []*HttpResponse{{Code: 202}, {Code: 202}, {Code: 200}}
+
+	Convey("repeat the last response", t, func() {
+		q := &HttpSequence{Responses: responses}
+		So(q.compile(), ShouldBeNil)
+		steps := []int{}
+		for i := 0; i < 5; i++ {
+			steps = append(steps, q.next(""))
+		}
+		So(steps, ShouldResemble, []int{0, 1, 2, 2, 2})
+	})
+
+	Convey("loop over responses", t, func() {
+		q := &HttpSequence{Responses: responses, Loop: true}
+		So(q.compile(), ShouldBeNil)
+		steps := []int{}
+		for i := 0; i < 5; i++ {
+			steps = append(steps, q.next(""))
+		}
+		So(steps, ShouldResemble, []int{0, 1, 2, 0, 1})
+	})
+
+	Convey("reset counters by key", t, func() {
+		q := &HttpSequence{Responses: responses}
+		So(q.compile(), ShouldBeNil)
+		q.next("a")
+		q.next("b")
+		q.reset("a")
+		So(q.next("a"), ShouldEqual, 0)
+		So(q.next("b"), ShouldEqual, 1)
+		q.reset("")
+		So(q.next("b"), ShouldEqual, 0)
+	})
+
+	Convey("check sequence", t, func() {
+		So((&HttpSequence{}).compile(), ShouldNotBeNil)
+		So((&HttpSequence{Responses: responses, Key: "header"}).compile(), ShouldNotBeNil)
+		So((&HttpSequence{Responses: responses, Key: "body:id"}).compile(), ShouldNotBeNil)
+		So((&HttpSequence{Responses: responses, Key: "header:X-Test-Id"}).compile(), ShouldBeNil)
+	})
+}
+
+func TestSequenceResponses(t *testing.T) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+routes:
+  - uri: /job
+    sequence:
+      key: header:X-Test-Id
+      responses:
+        - code: 202
+        - code: 202
+        - body: done
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	poll := func(client string) int {
+		req := httptest.NewRequest("GET", "/job", nil)
+		req.Header.Set("X-Test-Id", client)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	Convey("keep steps per client", t, func() {
+		So(poll("a"), ShouldEqual, 202)
+		So(poll("a"), ShouldEqual, 202)
+		So(poll("b"), ShouldEqual, 202)
+		So(poll("a"), ShouldEqual, 200)
+		So(poll("a"), ShouldEqual, 200)
+		So(poll("b"), ShouldEqual, 202)
+	})
+
+	Convey("reset steps of client", t, func() {
+		s.ResetSequences("a")
+		So(poll("a"), ShouldEqual, 202)
+		So(poll("b"), ShouldEqual, 200)
+	})
+
+	Convey("reset steps on reload", t, func() {
+		So(s.ResetRoutes(), ShouldBeNil)
+		So(poll("b"), ShouldEqual, 202)
+	})
+
+	Convey("report sequence with oneof", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /job\n    oneof: [{code: 200}]\n    sequence:\n      responses: [{code: 202}]\n")), ShouldBeNil)
+		err := s.initRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "line 2: sequence and oneof can not be used together")
+	})
+}
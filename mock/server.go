@@ -0,0 +1,342 @@
+// Package mock implements moko mock servers, which can be started by moko
+// binary, or embedded in Go tests:
+//
+//	s := mock.NewHttpServer()
+//	if err := s.Load(cfgYAML); err != nil {
+//		t.Fatal(err)
+//	}
+//	addr, err := s.Start("127.0.0.1:0")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	t.Cleanup(func() { s.Shutdown() })
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gookit/slog"
+	"gopkg.in/yaml.v3"
+)
+
+// servers.yaml example
+//
+// admin: 127.0.0.1:9090 # optional admin API listener
+// servers:
+//   - name: api
+//     protocol: http
+//     cfg: http-mock.yml # relative to this file
+//   - name: resolver
+//     protocol: dns
+//     cfg: dns-mock.yml
+
+var ServerMap = serverMap{} // global server map
+
+type Server interface {
+	Init(cfgFile string) error
+	Serve(*sync.WaitGroup) error
+	Shutdown() error
+}
+
+// serverMap maps protocol name to server constructor, so that one process can
+// run several servers of the same protocol
+type serverMap map[string]func() Server
+
+func (m serverMap) Add(name string, newServer func() Server) {
+	m[name] = newServer
+}
+
+// Get returns a new server instance of protocol name
+func (m serverMap) Get(name string) (Server, error) {
+	newServer, exists := m[name]
+	if !exists {
+		return nil, errors.New("unknown protocol " + name)
+	}
+
+	return newServer(), nil
+}
+
+func (m serverMap) List() []string {
+	names := make([]string, len(m))
+
+	idx := 0
+	for name := range m {
+		names[idx] = name
+		idx++
+	}
+
+	return names
+}
+
+type ServersConfig struct {
+	Admin   string          `yaml:"admin"`
+	Servers []*ServerConfig `yaml:"servers"`
+}
+
+type ServerConfig struct {
+	Name     string `yaml:"name"`
+	Protocol string `yaml:"protocol"`
+	CfgFile  string `yaml:"cfg"`
+}
+
+// LoadServersConfig loads the servers listed in cfgFile. A cfg file without
+// "servers" key is a single server config of the given protocol.
+func LoadServersConfig(cfgFile string, protocol string) (*ServersConfig, error) {
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return nil, err
+	}
+	var c ServersConfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if len(c.Servers) == 0 {
+		return &ServersConfig{Servers: []*ServerConfig{{Name: protocol, Protocol: protocol, CfgFile: cfgFile}}}, nil
+	}
+
+	names := map[string]bool{}
+	for idx, sc := range c.Servers {
+		if sc.Protocol == "" {
+			return nil, fmt.Errorf("server #%d: protocol is not set", idx)
+		}
+		if sc.CfgFile == "" {
+			return nil, fmt.Errorf("server #%d: cfg is not set", idx)
+		}
+		if sc.Name == "" {
+			sc.Name = fmt.Sprintf("%s-%d", sc.Protocol, idx)
+		}
+		if names[sc.Name] {
+			return nil, fmt.Errorf("duplicated server name %s", sc.Name)
+		}
+		names[sc.Name] = true
+		// cfg path is relative to the servers config file
+		if !filepath.IsAbs(sc.CfgFile) {
+			sc.CfgFile = filepath.Join(filepath.Dir(cfgFile), sc.CfgFile)
+		}
+	}
+
+	return &c, nil
+}
+
+// Checker is implemented by servers which can check config without serving
+type Checker interface {
+	// Check loads and validates config of cfgFile without binding ports, all
+	// errors found are returned
+	Check(cfgFile string) error
+	// ListRoutes returns the effective normalized routes
+	ListRoutes() interface{}
+}
+
+// CheckConfig checks config of cfg, and returns the checked server
+func CheckConfig(cfg *ServerConfig) (Checker, error) {
+	server, err := ServerMap.Get(cfg.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	checker, ok := server.(Checker)
+	if !ok {
+		return nil, fmt.Errorf("%s server does not support config check", cfg.Protocol)
+	}
+
+	return checker, checker.Check(cfg.CfgFile)
+}
+
+// ServerGroup runs several servers and shuts them down together
+type ServerGroup struct {
+	servers map[string]Server
+	cfgs    map[string]*ServerConfig
+	names   []string // start order
+
+	wg      sync.WaitGroup // Serve() calls
+	running sync.WaitGroup // Serve() goroutines, used to detect all stopped
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewServerGroup() *ServerGroup {
+	return &ServerGroup{servers: map[string]Server{}, cfgs: map[string]*ServerConfig{}, done: make(chan struct{})}
+}
+
+// Start inits and serves server of cfg in background. Serve errors are only
+// logged, so one broken server does not stop the others.
+func (g *ServerGroup) Start(cfg *ServerConfig) error {
+	server, err := ServerMap.Get(cfg.Protocol)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(cfg.CfgFile); err != nil {
+		return err
+	}
+	if err := server.Init(cfg.CfgFile); err != nil {
+		return err
+	}
+
+	g.add(cfg, server)
+	g.wg.Add(1)
+	g.running.Add(1)
+	go func() {
+		defer g.running.Done()
+		if err := server.Serve(&g.wg); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Errorf("server %s stopped: %v", cfg.Name, err)
+		}
+	}()
+
+	return nil
+}
+
+func (g *ServerGroup) add(cfg *ServerConfig, server Server) {
+	g.servers[cfg.Name] = server
+	g.cfgs[cfg.Name] = cfg
+	g.names = append(g.names, cfg.Name)
+}
+
+func (g *ServerGroup) Len() int {
+	return len(g.servers)
+}
+
+// Done is closed when all started servers stopped serving
+func (g *ServerGroup) Done() <-chan struct{} {
+	g.once.Do(func() {
+		go func() {
+			g.running.Wait()
+			close(g.done)
+		}()
+	})
+
+	return g.done
+}
+
+func (g *ServerGroup) Shutdown() {
+	for _, name := range g.names {
+		if err := g.servers[name].Shutdown(); err != nil {
+			slog.Warnf("shutdown server %s error: %v", name, err)
+		}
+	}
+	g.wg.Wait()
+}
+
+// resolvePath resolves relative path against config file dir, and falls back
+// to path relative to working dir if it does not exist there
+func resolvePath(dir string, path string) string {
+	if dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	p := filepath.Join(dir, path)
+	if _, err := os.Stat(p); err != nil {
+		return path
+	}
+
+	return p
+}
+
+// configLists are config lists whose items are structs, data values are not
+// checked
+var (
+	configLists = map[string]bool{"routes": true, "hosts": true, "proxy": true}
+	dataKeys    = map[string]bool{"body": true, "data": true, "value": true, "mergePatch": true}
+)
+
+// nullItems returns errors of null items in config lists with their line, eg.
+// a stray "-" under routes, which would be decoded as nil. A top-level list is
+// checked as routes.
+func nullItems(data []byte, file string) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return nil // reported by decoding
+	}
+	var errs configErrors
+	var walk func(node *yaml.Node, key string)
+	walk = func(node *yaml.Node, key string) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for idx := 0; idx+1 < len(node.Content); idx += 2 {
+				if k := node.Content[idx].Value; !dataKeys[k] {
+					walk(node.Content[idx+1], k)
+				}
+			}
+		case yaml.SequenceNode:
+			for _, item := range node.Content {
+				if configLists[key] && item.Kind == yaml.ScalarNode && item.ShortTag() == "!!null" {
+					errs = append(errs, newConfigError(file, item.Line, "empty item of %s", key))
+					continue
+				}
+				walk(item, key)
+			}
+		}
+	}
+	walk(doc.Content[0], "routes")
+
+	return errs.Err()
+}
+
+// keyLine returns line of key in mapping node, or 0 if not found
+func keyLine(node *yaml.Node, key string) int {
+	if node.Kind != yaml.MappingNode {
+		return 0
+	}
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			return node.Content[idx].Line
+		}
+	}
+
+	return 0
+}
+
+// configError is an error of the config item at file:line
+type configError struct {
+	file string
+	line int
+	err  error
+}
+
+func newConfigError(file string, line int, format string, args ...interface{}) error {
+	return &configError{file: file, line: line, err: fmt.Errorf(format, args...)}
+}
+
+func (e *configError) Error() string {
+	switch {
+	case e.line == 0:
+		return e.err.Error()
+	case e.file == "":
+		return fmt.Sprintf("line %d: %v", e.line, e.err)
+	}
+
+	return fmt.Sprintf("%s:%d: %v", e.file, e.line, e.err)
+}
+
+// configErrors collects all errors of a config
+type configErrors []error
+
+// add adds err, errors collected in err are flattened
+func (e configErrors) add(err error) configErrors {
+	if errs, ok := err.(configErrors); ok {
+		return append(e, errs...)
+	}
+
+	return append(e, err)
+}
+
+func (e configErrors) Error() string {
+	msgs := make([]string, len(e))
+	for idx, err := range e {
+		msgs[idx] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Err returns nil if no error collected
+func (e configErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
@@ -0,0 +1,292 @@
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type mockServer struct{}
+
+func (s *mockServer) Init(cfgFile string) error {
+	return nil
+}
+
+func (s *mockServer) Serve(wg *sync.WaitGroup) error {
+	defer wg.Done()
+
+	return nil
+}
+
+func (s *mockServer) Shutdown() error {
+	return nil
+}
+
+type failedServer struct {
+	mockServer
+}
+
+func (s *failedServer) Init(cfgFile string) error {
+	return errors.New("init failed")
+}
+
+func TestServerMap(t *testing.T) {
+	Convey("get exist server", t, func() {
+		server, err := ServerMap.Get("http")
+		So(err, ShouldEqual, nil)
+		So(server, ShouldHaveSameTypeAs, &HttpServer{})
+		another, _ := ServerMap.Get("http")
+		So(another, ShouldNotPointTo, server)
+	})
+
+	Convey("get unknown server", t, func() {
+		server, err := ServerMap.Get("does-not-exist")
+		So(err, ShouldNotEqual, nil)
+		So(server, ShouldEqual, nil)
+	})
+
+	Convey("add new server", t, func() {
+		server, err := ServerMap.Get("new-not-exist")
+		So(err, ShouldNotEqual, nil)
+		So(server, ShouldEqual, nil)
+		ServerMap.Add("new-not-exist", func() Server { return &mockServer{} })
+		server, err = ServerMap.Get("new-not-exist")
+		So(err, ShouldBeNil)
+		So(server, ShouldNotBeNil)
+	})
+
+	Convey("list server names", t, func() {
+		m := serverMap{}
+		So(len(m.List()), ShouldEqual, 0)
+		m.Add("new-not-exist", func() Server { return &mockServer{} })
+		So(m.List(), ShouldResemble, []string{"new-not-exist"})
+		m.Add("new-not-exist2", func() Server { return &mockServer{} })
+		mlist := m.List()
+		sort.SliceStable(mlist, func(i, j int) bool {
+			return mlist[i] < mlist[j]
+		})
+		So(mlist, ShouldResemble, []string{"new-not-exist", "new-not-exist2"})
+	})
+}
+
+func TestServersConfig(t *testing.T) {
+	Convey("single server cfg file", t, func() {
+		c, err := LoadServersConfig("../examples/http-mock.yml", "http")
+		So(err, ShouldBeNil)
+		So(c.Admin, ShouldEqual, "")
+		cfgs := c.Servers
+		So(len(cfgs), ShouldEqual, 1)
+		So(*cfgs[0], ShouldResemble, ServerConfig{Name: "http", Protocol: "http", CfgFile: "../examples/http-mock.yml"})
+	})
+
+	Convey("servers cfg file", t, func() {
+		c, err := LoadServersConfig("../examples/servers.yml", "http")
+		So(err, ShouldBeNil)
+		So(c.Admin, ShouldEqual, "127.0.0.1:9090")
+		cfgs := c.Servers
+		So(len(cfgs), ShouldEqual, 2)
+		So(*cfgs[0], ShouldResemble, ServerConfig{Name: "api", Protocol: "http", CfgFile: "../examples/http-mock.yml"})
+		So(*cfgs[1], ShouldResemble, ServerConfig{Name: "resolver", Protocol: "dns", CfgFile: "../examples/dns-mock.yml"})
+	})
+}
+
+func TestCheckConfig(t *testing.T) {
+	Convey("check valid configs", t, func() {
+		c, err := LoadServersConfig("../examples/servers.yml", "")
+		So(err, ShouldBeNil)
+		for _, cfg := range c.Servers {
+			_, err := CheckConfig(cfg)
+			So(err, ShouldBeNil)
+		}
+	})
+
+	Convey("report all HTTP config errors with file and line", t, func() {
+		file := filepath.Join(t.TempDir(), "http-mock.yml")
+		os.WriteFile(file, []byte("routes:\n  - uri: /hello/:name\n  - uri: /hello/:id\n  - uri: /hello\n    method: fetch\n"), 0644)
+		_, err := CheckConfig(&ServerConfig{Name: "api", Protocol: "http", CfgFile: file})
+		So(err, ShouldNotBeNil)
+		errs := err.(configErrors)
+		So(errs, ShouldHaveLength, 2)
+		So(errs[0].Error(), ShouldEqual, file+":4: unsupported method FETCH")
+		So(errs[1].Error(), ShouldStartWith, file+":3: ")
+	})
+
+	Convey("report missing cert file", t, func() {
+		file := filepath.Join(t.TempDir(), "https-mock.yml")
+		os.WriteFile(file, []byte("cert: missing.pem\nkey: missing.key\nhosts:\n  - host: a.test\n    cert: a.pem\n    key: a.key\n"), 0644)
+		_, err := CheckConfig(&ServerConfig{Name: "api", Protocol: "http", CfgFile: file})
+		So(err, ShouldNotBeNil)
+		errs := err.(configErrors)
+		So(errs, ShouldHaveLength, 4)
+		So(errs[0].Error(), ShouldStartWith, file+":1: stat ")
+		So(errs[0].Error(), ShouldContainSubstring, "missing.pem")
+		So(errs[1].Error(), ShouldStartWith, file+":2: stat ")
+		So(errs[2].Error(), ShouldStartWith, file+":5: stat ")
+		So(errs[3].Error(), ShouldStartWith, file+":6: stat ")
+		So(errs[3].Error(), ShouldContainSubstring, "a.key")
+	})
+
+	Convey("report DNS config errors and normalize records", t, func() {
+		file := filepath.Join(t.TempDir(), "dns-mock.yml")
+		os.WriteFile(file, []byte("parent: 114.114.114.114\nroutes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.300\n"), 0644)
+		server, err := CheckConfig(&ServerConfig{Name: "resolver", Protocol: "dns", CfgFile: file})
+		So(err, ShouldNotBeNil)
+		errs := err.(configErrors)
+		So(errs, ShouldHaveLength, 2)
+		So(errs[0].Error(), ShouldEqual, file+":3: invalid ip addr: 127.0.0.300")
+		So(errs[1].Error(), ShouldStartWith, file+": invalid parent DNS")
+		So(server.ListRoutes().([]*Record)[0].Fqdn, ShouldEqual, "www.my.internal.")
+	})
+
+	Convey("report config errors together with route errors", t, func() {
+		file := filepath.Join(t.TempDir(), "dns-mock.yml")
+		os.WriteFile(file, []byte("protocol: sctp\nport: 70000\nroutes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.300\n"), 0644)
+		_, err := CheckConfig(&ServerConfig{Name: "resolver", Protocol: "dns", CfgFile: file})
+		So(err, ShouldNotBeNil)
+		errs := err.(configErrors)
+		So(errs, ShouldHaveLength, 3)
+		So(errs[0].Error(), ShouldEqual, "unsupported protocol: sctp")
+		So(errs[1].Error(), ShouldEqual, "invalid port: 70000")
+		So(errs[2].Error(), ShouldEqual, file+":4: invalid ip addr: 127.0.0.300")
+
+		file = filepath.Join(t.TempDir(), "http-mock.yml")
+		os.WriteFile(file, []byte("port: -1\ncert: missing.pem\nroutes:\n  - uri: /hello\n    method: fetch\n"), 0644)
+		_, err = CheckConfig(&ServerConfig{Name: "api", Protocol: "http", CfgFile: file})
+		So(err, ShouldNotBeNil)
+		errs = err.(configErrors)
+		So(errs, ShouldHaveLength, 3)
+		So(errs[0].Error(), ShouldStartWith, file+":2: stat ")
+		So(errs[1].Error(), ShouldEqual, "invalid port: -1")
+		So(errs[2].Error(), ShouldEqual, file+":4: unsupported method FETCH")
+	})
+
+	Convey("report yaml error with file", t, func() {
+		file := filepath.Join(t.TempDir(), "http-mock.yml")
+		os.WriteFile(file, []byte("routes: {"), 0644)
+		_, err := CheckConfig(&ServerConfig{Name: "api", Protocol: "http", CfgFile: file})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldStartWith, file+": yaml: line 1")
+	})
+
+	Convey("unknown protocol", t, func() {
+		_, err := CheckConfig(&ServerConfig{Name: "x", Protocol: "does-not-exist", CfgFile: "x.yml"})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestServerGroup(t *testing.T) {
+	ServerMap.Add("mock", func() Server { return &mockServer{} })
+	ServerMap.Add("failed", func() Server { return &failedServer{} })
+
+	Convey("start servers and skip failed ones", t, func() {
+		g := NewServerGroup()
+		So(g.Start(&ServerConfig{Name: "ok", Protocol: "mock", CfgFile: "../examples/servers.yml"}), ShouldBeNil)
+		So(g.Start(&ServerConfig{Name: "bad", Protocol: "failed", CfgFile: "../examples/servers.yml"}), ShouldNotBeNil)
+		So(g.Start(&ServerConfig{Name: "unknown", Protocol: "does-not-exist", CfgFile: "../examples/servers.yml"}), ShouldNotBeNil)
+		So(g.Start(&ServerConfig{Name: "missing", Protocol: "mock", CfgFile: "../examples/does-not-exist.yml"}), ShouldNotBeNil)
+		So(g.Len(), ShouldEqual, 1)
+		<-g.Done() // mock server returns immediately
+		g.Shutdown()
+	})
+}
+
+func TestReloadUnderTraffic(t *testing.T) {
+	hs := NewHttpServer()
+	if err := hs.Load([]byte("routes:\n  - uri: /hello\n    response:\n      body: v1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hs.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { hs.Shutdown() })
+	ds := NewDNSServer()
+	if err := ds.Load([]byte("routes:\n  - rrtype: A\n    fqdn: www.my.internal\n    ip: 127.0.0.1\n")); err != nil {
+		t.Fatal(err)
+	}
+	dnsAddr, err := ds.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ds.Shutdown() })
+
+	Convey("serve old or new routes while reloading", t, func() {
+		stop := make(chan struct{})
+		errs := make(chan error, 100)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					resp, err := http.Get(hs.URL() + "/hello")
+					if err != nil {
+						errs <- err
+						return
+					}
+					body, _ := io.ReadAll(resp.Body)
+					resp.Body.Close()
+					if string(body) != "v1" && string(body) != "v2" {
+						errs <- fmt.Errorf("unexpected body %s", body)
+						return
+					}
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				client := dns.Client{Net: "udp4"}
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					m := new(dns.Msg)
+					m.SetQuestion("www.my.internal.", dns.TypeA)
+					r, _, err := client.Exchange(m, dnsAddr.String())
+					if err != nil {
+						errs <- err
+						return
+					}
+					if len(r.Answer) != 1 {
+						errs <- fmt.Errorf("unexpected answers %v", r.Answer)
+						return
+					}
+				}
+			}()
+		}
+
+		for i := 0; i < 50; i++ {
+			So(hs.SetRoutes([]byte(`[{"uri": "/hello", "response": {"body": "v2"}}]`)), ShouldBeNil)
+			So(hs.AddRoute([]byte(`{"uri": "/other", "response": {"body": "other"}}`)), ShouldBeNil)
+			So(hs.UpdateRoute(0, []byte(`{"uri": "/hello", "response": {"body": "v2", "headers": {"X-Version": "${uuid}"}}}`)), ShouldBeNil)
+			So(hs.DeleteRoute(1), ShouldBeNil)
+			So(ds.SetRoutes([]byte(`[{"rrtype": "A", "fqdn": "www.my.internal", "ip": "127.0.0.2"}]`)), ShouldBeNil)
+			time.Sleep(2 * time.Millisecond)
+			So(hs.ResetRoutes(), ShouldBeNil)
+			So(ds.ResetRoutes(), ShouldBeNil)
+			time.Sleep(2 * time.Millisecond)
+		}
+		close(stop)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			So(err, ShouldBeNil)
+		}
+	})
+}
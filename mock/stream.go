@@ -0,0 +1,235 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gookit/slog"
+	"gopkg.in/yaml.v3"
+)
+
+// streaming response example
+//
+// routes:
+//   - uri: /events
+//     response:
+//       stream:
+//         delay: 100 # default delay before each event or chunk in milliseconds
+//         keepOpen: true # hold stream open after the last one until client disconnects
+//         events: # server-sent events, or raw chunks
+//           - event: message
+//             id: "1"
+//             data: hello ${name}
+//           - data: {done: true} # structure is sent as JSON
+//             retry: 1000
+//   - uri: /chunks
+//     response:
+//       stream:
+//         chunks:
+//           - data: "part 1\n"
+//           - data: "part 2\n"
+//             delay: 500
+
+// HttpStream streams server-sent events or raw chunks, flushed one by one
+type HttpStream struct {
+	Delay    int            `yaml:"delay,omitempty"`
+	KeepOpen bool           `yaml:"keepOpen,omitempty"`
+	Events   []*StreamEvent `yaml:"events,omitempty"`
+	Chunks   []*StreamChunk `yaml:"chunks,omitempty"`
+}
+
+// StreamEvent is a server-sent event, data is rendered as template
+type StreamEvent struct {
+	Event string      `yaml:"event,omitempty"`
+	Id    string      `yaml:"id,omitempty"`
+	Data  interface{} `yaml:"data,omitempty"` // string, or structure sent as JSON
+	Retry int         `yaml:"retry,omitempty"`
+	Delay int         `yaml:"delay,omitempty"` // delay before event in milliseconds, overrides stream delay
+
+	data *dataTemplate
+}
+
+// StreamChunk is a raw chunk, data is rendered as template
+type StreamChunk struct {
+	Data  string `yaml:"data"`
+	Delay int    `yaml:"delay,omitempty"` // delay before chunk in milliseconds, overrides stream delay
+
+	data *textTemplate
+}
+
+// UnmarshalYAML decodes structured data keeping key order and numbers as
+// written in YAML
+func (e *StreamEvent) UnmarshalYAML(node *yaml.Node) error {
+	type plain StreamEvent
+	if err := node.Decode((*plain)(e)); err != nil {
+		return err
+	}
+
+	return yamlField(node, "data", &e.Data)
+}
+
+func (st *HttpStream) clone() *HttpStream {
+	if st == nil {
+		return nil
+	}
+	c := &HttpStream{Delay: st.Delay, KeepOpen: st.KeepOpen}
+	for _, e := range st.Events {
+		if e != nil {
+			ce := *e
+			e = &ce
+		}
+		c.Events = append(c.Events, e)
+	}
+	for _, ch := range st.Chunks {
+		if ch != nil {
+			cc := *ch
+			ch = &cc
+		}
+		c.Chunks = append(c.Chunks, ch)
+	}
+
+	return c
+}
+
+func (st *HttpStream) compile() error {
+	switch {
+	case len(st.Events) > 0 && len(st.Chunks) > 0:
+		return errors.New("stream events and chunks can not be used together")
+	case len(st.Events) == 0 && len(st.Chunks) == 0 && !st.KeepOpen:
+		return errors.New("stream events and chunks are empty")
+	}
+	events := make([]*dataTemplate, len(st.Events))
+	for idx, e := range st.Events {
+		if e == nil {
+			return fmt.Errorf("stream event %d is empty", idx)
+		}
+		data, err := newDataTemplate(e.Data)
+		if err != nil {
+			return fmt.Errorf("stream event %d: %v", idx, err)
+		}
+		events[idx] = data
+	}
+	chunks := make([]*textTemplate, len(st.Chunks))
+	for idx, c := range st.Chunks {
+		if c == nil {
+			return fmt.Errorf("stream chunk %d is empty", idx)
+		}
+		data, err := newTextTemplate(c.Data)
+		if err != nil {
+			return fmt.Errorf("stream chunk %d: %v", idx, err)
+		}
+		chunks[idx] = data
+	}
+
+	// assign only when all templates compile
+	for idx, e := range st.Events {
+		e.data = events[idx]
+	}
+	for idx, c := range st.Chunks {
+		c.data = chunks[idx]
+	}
+
+	return nil
+}
+
+// setHeaders sets default headers of stream
+func (st *HttpStream) setHeaders(h http.Header) {
+	if len(st.Events) > 0 || len(st.Chunks) == 0 {
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+	}
+}
+
+// serve writes and flushes events or chunks one by one, until all written (or
+// client disconnects if keepOpen)
+func (st *HttpStream) serve(ctx context.Context, w http.ResponseWriter, params map[string]interface{}) {
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush() // send headers
+
+	for _, e := range st.Events {
+		if !st.wait(ctx, e.Delay) {
+			return
+		}
+		if err := e.write(w, params); err != nil {
+			slog.Errorf("write stream event error: %v", err)
+			return
+		}
+		flush()
+	}
+	for _, c := range st.Chunks {
+		if !st.wait(ctx, c.Delay) {
+			return
+		}
+		data, err := c.data.render(params)
+		if err != nil {
+			slog.Errorf("render stream chunk error: %v", err)
+		}
+		if _, err := io.WriteString(w, data); err != nil {
+			return
+		}
+		flush()
+	}
+	if st.KeepOpen {
+		<-ctx.Done()
+	}
+}
+
+// wait waits for delay, or stream delay if delay is 0, and reports whether
+// stream is still open
+func (st *HttpStream) wait(ctx context.Context, delay int) bool {
+	if delay == 0 {
+		delay = st.Delay
+	}
+
+	return sleep(ctx, delay)
+}
+
+// sleep waits for delay in milliseconds, and reports whether ctx is not done
+func sleep(ctx context.Context, delay int) bool {
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(time.Duration(delay) * time.Millisecond)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (e *StreamEvent) write(w io.Writer, params map[string]interface{}) error {
+	rendered, err := e.data.render(params)
+	if err != nil {
+		slog.Errorf("render stream event error: %v", err)
+	}
+
+	var b strings.Builder
+	if e.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.Event)
+	}
+	if e.Id != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.Id)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", e.Retry)
+	}
+	for _, line := range strings.Split(rendered, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err = io.WriteString(w, b.String())
+
+	return err
+}
@@ -0,0 +1,162 @@
+package mock
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v3"
+)
+
+func TestStreamEvent(t *testing.T) {
+	Convey("write event fields", t, func() {
+		var b strings.Builder
+		e := &StreamEvent{Event: "message", Id: "1", Retry: 1000, Data: "hello ${name}\nbye"}
+		So((&HttpStream{Events: []*StreamEvent{e}}).compile(), ShouldBeNil)
+		So(e.write(&b, map[string]interface{}{"name": "world"}), ShouldBeNil)
+		So(b.String(), ShouldEqual, "event: message\nid: 1\nretry: 1000\ndata: hello world\ndata: bye\n\n")
+	})
+
+	Convey("write structure data as JSON", t, func() {
+		var b strings.Builder
+		e := &StreamEvent{Data: map[string]interface{}{"done": true}}
+		So((&HttpStream{Events: []*StreamEvent{e}}).compile(), ShouldBeNil)
+		So(e.write(&b, nil), ShouldBeNil)
+		So(b.String(), ShouldEqual, "data: {\"done\":true}\n\n")
+	})
+
+	Convey("keep key order and numbers of data", t, func() {
+		var b strings.Builder
+		var e StreamEvent
+		So(yaml.Unmarshal([]byte("data: {z: 1, a: 1.50}"), &e), ShouldBeNil)
+		So((&HttpStream{Events: []*StreamEvent{&e}}).compile(), ShouldBeNil)
+		So(e.write(&b, nil), ShouldBeNil)
+		So(b.String(), ShouldEqual, "data: {\"z\":1,\"a\":1.50}\n\n")
+	})
+
+	Convey("check stream", t, func() {
+		So((&HttpStream{}).compile(), ShouldNotBeNil)
+		So((&HttpStream{KeepOpen: true}).compile(), ShouldBeNil)
+		So((&HttpStream{Events: []*StreamEvent{{}}, Chunks: []*StreamChunk{{}}}).compile(), ShouldNotBeNil)
+		So((&HttpStream{Chunks: []*StreamChunk{nil}}).compile(), ShouldNotBeNil)
+	})
+}
+
+func TestStreamResponses(t *testing.T) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+routes:
+  - uri: /events/:name
+    response:
+      stream:
+        events:
+          - event: greeting
+            data: hello ${name}
+          - data: {done: true}
+  - uri: /chunks
+    response:
+      headers:
+        Content-Type: text/plain
+      stream:
+        delay: 50
+        chunks:
+          - data: "part 1\n"
+          - data: "part 2\n"
+  - uri: /open
+    response:
+      stream:
+        keepOpen: true
+        events:
+          - data: ready
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := s.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + addr.String()
+
+	Convey("stream server-sent events", t, func() {
+		resp, err := http.Get(url + "/events/world")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+		So(resp.Header.Get("Cache-Control"), ShouldEqual, "no-cache")
+		body, _ := io.ReadAll(resp.Body)
+		So(string(body), ShouldEqual, "event: greeting\ndata: hello world\n\ndata: {\"done\":true}\n\n")
+	})
+
+	Convey("stream chunks with delay", t, func() {
+		start := time.Now()
+		resp, err := http.Get(url + "/chunks")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "text/plain")
+		So(resp.TransferEncoding, ShouldResemble, []string{"chunked"})
+		r := bufio.NewReader(resp.Body)
+		line, _ := r.ReadString('\n')
+		So(line, ShouldEqual, "part 1\n")
+		line, _ = r.ReadString('\n')
+		So(line, ShouldEqual, "part 2\n")
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 100*time.Millisecond)
+	})
+
+	Convey("hold stream open until client disconnects", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, "GET", url+"/open", nil)
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		r := bufio.NewReader(resp.Body)
+		line, _ := r.ReadString('\n')
+		So(line, ShouldEqual, "data: ready\n")
+		cancel()
+		_, err = io.ReadAll(r)
+		So(err, ShouldNotBeNil)
+		resp.Body.Close()
+	})
+
+	Convey("end open streams on shutdown", t, func() {
+		resp, err := http.Get(url + "/open")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		r := bufio.NewReader(resp.Body)
+		line, _ := r.ReadString('\n')
+		So(line, ShouldEqual, "data: ready\n")
+		done := make(chan error, 1)
+		go func() { done <- s.Shutdown() }()
+		_, err = io.ReadAll(r)
+		So(err, ShouldBeNil)
+		select {
+		case err := <-done:
+			So(err, ShouldBeNil)
+		case <-time.After(2 * time.Second):
+			So("shutdown timeout", ShouldBeEmpty)
+		}
+	})
+
+	Convey("report stream with body", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /events\n    response:\n      body: hello\n      stream:\n        keepOpen: true\n")), ShouldBeNil)
+		err := s.initRoutes()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldEqual, "line 2: only one of body, bodyFile, bodyBase64 and stream can be used")
+	})
+
+	Convey("stream with recorder", t, func() {
+		s := NewHttpServer()
+		So(s.Load([]byte("routes:\n  - uri: /events\n    response:\n      stream:\n        events: [{data: a}, {data: b}]\n")), ShouldBeNil)
+		So(s.initRoutes(), ShouldBeNil)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+		So(w.Flushed, ShouldBeTrue)
+		So(w.Body.String(), ShouldEqual, "data: a\n\ndata: b\n\n")
+	})
+}
@@ -0,0 +1,221 @@
+package mock
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gookit/slog"
+)
+
+const defaultDebounce = 100 * time.Millisecond
+
+// FileWatcher calls reload callback when content of the config file or its
+// included files changed. Parent dirs are watched instead of files, so files
+// saved by rename or replace (eg. vim, atomic writes) are still tracked.
+type FileWatcher struct {
+	Debounce time.Duration   // wait for bursts of write events, default 100ms
+	OnReload func(err error) // called after each reload with reload result
+
+	mu       sync.Mutex
+	reloadMu sync.Mutex // serializes reload
+	watcher  *fsnotify.Watcher
+	file     string
+	files    map[string][]byte // {abs path: content hash} of file and included files
+	dirs     map[string]bool
+	reload   func() error
+	timer    *time.Timer
+	stopped  bool // no reload after Stop, checked under mu
+}
+
+func NewFileWatcher() *FileWatcher {
+	return &FileWatcher{Debounce: defaultDebounce, files: map[string][]byte{}, dirs: map[string]bool{}}
+}
+
+// Watch calls reload when file content changed
+func (w *FileWatcher) Watch(file string, reload func() error) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	file, err = filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	w.watcher = watcher
+	w.file = file
+	w.reload = reload
+	w.mu.Unlock()
+	if err := w.Include(); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go w.loop(watcher)
+
+	return nil
+}
+
+// Include replaces the files watched along with config file
+func (w *FileWatcher) Include(files ...string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.watcher == nil {
+		return nil
+	}
+	watched := map[string][]byte{w.file: w.files[w.file]}
+	if watched[w.file] == nil {
+		watched[w.file] = hashFile(w.file)
+	}
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return err
+		}
+		if hash, exists := w.files[abs]; exists {
+			watched[abs] = hash
+		} else {
+			watched[abs] = hashFile(abs)
+		}
+	}
+	for f := range watched {
+		dir := filepath.Dir(f)
+		if w.dirs[dir] {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			return err
+		}
+		w.dirs[dir] = true
+	}
+	w.files = watched
+
+	return nil
+}
+
+func (w *FileWatcher) loop(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			w.mu.Lock()
+			if _, watched := w.files[filepath.Clean(event.Name)]; watched && !w.stopped {
+				slog.Debugf("file event: %s", event)
+				if w.timer != nil {
+					w.timer.Stop()
+				}
+				w.timer = time.AfterFunc(w.Debounce, w.check)
+			}
+			w.mu.Unlock()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Errorf("watch file error: %v", err)
+		}
+	}
+}
+
+// check calls reload if content of any watched file changed
+func (w *FileWatcher) check() {
+	reloaded, err := w.checkReload()
+	if !reloaded {
+		return
+	}
+	w.mu.Lock()
+	onReload := w.OnReload
+	w.mu.Unlock()
+	if onReload != nil { // called out of reload lock, so it may stop watcher
+		onReload(err)
+	}
+}
+
+// checkReload calls reload if content of any watched file changed, and
+// reports whether reload is called
+func (w *FileWatcher) checkReload() (bool, error) {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	w.mu.Lock()
+	if w.stopped { // timer fired before Stop
+		w.mu.Unlock()
+		return false, nil
+	}
+	changed := []string{}
+	for f, hash := range w.files {
+		newHash := hashFile(f)
+		if !bytes.Equal(hash, newHash) {
+			changed = append(changed, f)
+			w.files[f] = newHash
+		}
+	}
+	reload := w.reload
+	w.mu.Unlock()
+	if len(changed) == 0 {
+		return false, nil
+	}
+
+	slog.Infof("files %v changed, reload config %s", changed, w.file)
+	err := safeReload(reload)
+	if err != nil {
+		slog.Errorf("reload config %s error: %v", w.file, err)
+	} else {
+		slog.Infof("reload config %s success", w.file)
+	}
+
+	return true, err
+}
+
+// Stop stops watching, and waits for reload in progress to finish. No reload
+// is called after Stop returns.
+func (w *FileWatcher) Stop() {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopped = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if w.watcher != nil {
+		w.watcher.Close()
+		w.watcher = nil
+	}
+}
+
+// hashFile returns content hash of file, or nil if file can not be read
+func hashFile(file string) []byte {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	hash := sha256.Sum256(data)
+
+	return hash[:]
+}
+
+// safeReload calls reload, a panic is returned as error so that the previous
+// config is kept
+func safeReload(reload func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("reload panic: %v", r)
+		}
+	}()
+
+	return reload()
+}
@@ -0,0 +1,138 @@
+package mock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFileWatcher(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "mock.yml")
+	included := filepath.Join(dir, "included.yml")
+	os.WriteFile(file, []byte("v1"), 0644)
+	os.WriteFile(included, []byte("v1"), 0644)
+
+	reloaded := make(chan error, 10)
+	w := NewFileWatcher()
+	w.Debounce = 20 * time.Millisecond
+	w.OnReload = func(err error) { reloaded <- err }
+	if err := w.Watch(file, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	waitReload := func() int {
+		count := 0
+		for {
+			select {
+			case <-reloaded:
+				count++
+			case <-time.After(200 * time.Millisecond):
+				return count
+			}
+		}
+	}
+
+	Convey("reload once on bursts of writes", t, func() {
+		for _, v := range []string{"v2", "v3", "v4"} {
+			os.WriteFile(file, []byte(v), 0644)
+		}
+		So(waitReload(), ShouldEqual, 1)
+	})
+
+	Convey("skip reload if content not changed", t, func() {
+		os.WriteFile(file, []byte("v4"), 0644)
+		So(waitReload(), ShouldEqual, 0)
+	})
+
+	Convey("reload on file replaced by rename", t, func() {
+		tmp := filepath.Join(dir, "mock.yml.tmp")
+		os.WriteFile(tmp, []byte("v5"), 0644)
+		So(os.Rename(tmp, file), ShouldBeNil)
+		So(waitReload(), ShouldEqual, 1)
+	})
+
+	Convey("reload on included file changed", t, func() {
+		os.WriteFile(included, []byte("v2"), 0644)
+		So(waitReload(), ShouldEqual, 0)
+		So(w.Include(included), ShouldBeNil)
+		os.WriteFile(included, []byte("v3"), 0644)
+		So(waitReload(), ShouldEqual, 1)
+	})
+
+	Convey("report reload panic as error", t, func() {
+		panicked := filepath.Join(dir, "panic.yml")
+		os.WriteFile(panicked, []byte("v1"), 0644)
+		errs := make(chan error, 10)
+		w := NewFileWatcher()
+		w.Debounce = 20 * time.Millisecond
+		w.OnReload = func(err error) { errs <- err }
+		So(w.Watch(panicked, func() error { panic("boom") }), ShouldBeNil)
+		defer w.Stop()
+		os.WriteFile(panicked, []byte("v2"), 0644)
+		select {
+		case err := <-errs:
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "reload panic: boom")
+		case <-time.After(time.Second):
+			So("reload timeout", ShouldBeEmpty)
+		}
+	})
+
+	Convey("no reload after stop", t, func() {
+		stopped := filepath.Join(dir, "stopped.yml")
+		os.WriteFile(stopped, []byte("v1"), 0644)
+		reloads := make(chan struct{}, 10)
+		w := NewFileWatcher()
+		w.Debounce = 20 * time.Millisecond
+		So(w.Watch(stopped, func() error {
+			reloads <- struct{}{}
+			return nil
+		}), ShouldBeNil)
+		os.WriteFile(stopped, []byte("v2"), 0644)
+		w.Stop()
+		w.check() // timer fired before Stop
+		os.WriteFile(stopped, []byte("v3"), 0644)
+		select {
+		case <-reloads:
+			So("reload after stop", ShouldBeEmpty)
+		case <-time.After(200 * time.Millisecond):
+		}
+	})
+}
+
+func TestHTTPServerReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "http-mock.yml")
+	included := filepath.Join(dir, "included.yml")
+	os.WriteFile(file, []byte("include: [included.yml]\nroutes:\n  - uri: /hello\n"), 0644)
+	os.WriteFile(included, []byte("routes:\n  - uri: /included\n"), 0644)
+
+	reloaded := make(chan error, 10)
+	s := NewHttpServer()
+	s.OnReload = func(err error) { reloaded <- err }
+	if err := s.Init(file); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+
+	Convey("load included routes", t, func() {
+		So(getUris(s.Routes), ShouldResemble, []string{"GET /hello", "GET /included"})
+	})
+
+	Convey("reload included routes", t, func() {
+		os.WriteFile(included, []byte("routes:\n  - uri: /included\n  - uri: /more\n"), 0644)
+		So(<-reloaded, ShouldBeNil)
+		So(getUris(s.ListRoutes().([]*HttpRoute)), ShouldResemble, []string{"GET /hello", "GET /included", "GET /more"})
+	})
+
+	Convey("report reload error", t, func() {
+		os.WriteFile(file, []byte("routes: {"), 0644)
+		So(<-reloaded, ShouldNotBeNil)
+		So(len(s.ListRoutes().([]*HttpRoute)), ShouldEqual, 3)
+	})
+}
@@ -0,0 +1,465 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gookit/slog"
+	"github.com/gorilla/websocket"
+	"gopkg.in/yaml.v3"
+)
+
+// websocket script example
+//
+// routes:
+//   - uri: /ws/:room
+//     websocket:
+//       onConnect: # sent on connect
+//         - data: welcome to ${room}
+//       replies: # the first reply matching incoming message is sent
+//         - match: ping # whole message, same as {equals: ping}
+//           send:
+//             - data: pong
+//         - match: {regex: "^join (?P<user>\\w+)$"} # named groups are captured
+//           send:
+//             - data: hello ${user}
+//         - json: # JSON message, keyed by JSONPath, fields of object are captured
+//             $.type: subscribe
+//           send:
+//             - data: {type: subscribed, channel: "${channel}"} # structure is sent as JSON
+//               delay: 100
+//         - match: bye
+//           close: {code: 4000, reason: bye}
+//       push: # periodic server pushes
+//         - interval: 1000 # in milliseconds
+//           count: 10 # 0 is unlimited
+//           data: tick
+//       close: # close after connected for a while
+//         after: 60000
+//         code: 1000
+
+const wsCloseTimeout = time.Second // wait for close reply of client
+
+var wsUpgrader = websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+// HttpWebsocket upgrades route to WebSocket and runs a script of messages
+type HttpWebsocket struct {
+	OnConnect []*WsMessage `yaml:"onConnect,omitempty"`
+	Replies   []*WsReply   `yaml:"replies,omitempty"`
+	Pushes    []*WsPush    `yaml:"push,omitempty"`
+	Close     *WsClose     `yaml:"close,omitempty"`
+}
+
+// WsMessage is a message sent to client, data is rendered as template
+type WsMessage struct {
+	Data   interface{} `yaml:"data"` // string, or structure sent as JSON
+	Binary bool        `yaml:"binary,omitempty"`
+	Delay  int         `yaml:"delay,omitempty"` // delay before message in milliseconds
+
+	data *dataTemplate
+}
+
+// WsReply sends messages, or closes connection, if incoming message matches
+type WsReply struct {
+	Match *Matcher            `yaml:"match,omitempty"` // matches whole message, any message if not set
+	Json  map[string]*Matcher `yaml:"json,omitempty"`  // keyed by JSONPath, "$" is the whole message
+	Send  []*WsMessage        `yaml:"send,omitempty"`
+	Close *WsClose            `yaml:"close,omitempty"` // close after messages sent
+}
+
+// WsPush sends message periodically
+type WsPush struct {
+	Interval int         `yaml:"interval"` // in milliseconds
+	Count    int         `yaml:"count,omitempty"`
+	Data     interface{} `yaml:"data"`
+	Binary   bool        `yaml:"binary,omitempty"`
+
+	data *dataTemplate
+}
+
+// WsClose closes connection with code and reason
+type WsClose struct {
+	Code   int    `yaml:"code,omitempty"` // default 1000
+	Reason string `yaml:"reason,omitempty"`
+	After  int    `yaml:"after,omitempty"` // delay before close in milliseconds
+}
+
+// UnmarshalYAML decodes structured data keeping key order and numbers as
+// written in YAML
+func (m *WsMessage) UnmarshalYAML(node *yaml.Node) error {
+	type plain WsMessage
+	if err := node.Decode((*plain)(m)); err != nil {
+		return err
+	}
+
+	return yamlField(node, "data", &m.Data)
+}
+
+func (p *WsPush) UnmarshalYAML(node *yaml.Node) error {
+	type plain WsPush
+	if err := node.Decode((*plain)(p)); err != nil {
+		return err
+	}
+
+	return yamlField(node, "data", &p.Data)
+}
+
+func (ws *HttpWebsocket) clone() *HttpWebsocket {
+	if ws == nil {
+		return nil
+	}
+	c := &HttpWebsocket{OnConnect: cloneMessages(ws.OnConnect), Close: ws.Close}
+	for _, p := range ws.Replies {
+		if p != nil {
+			cp := *p
+			cp.Match = p.Match.clone()
+			cp.Json = cloneMatchers(p.Json)
+			cp.Send = cloneMessages(p.Send)
+			p = &cp
+		}
+		c.Replies = append(c.Replies, p)
+	}
+	for _, p := range ws.Pushes {
+		if p != nil {
+			cp := *p
+			p = &cp
+		}
+		c.Pushes = append(c.Pushes, p)
+	}
+
+	return c
+}
+
+func cloneMessages(messages []*WsMessage) []*WsMessage {
+	if messages == nil {
+		return nil
+	}
+	clones := make([]*WsMessage, len(messages))
+	for idx, m := range messages {
+		if m != nil {
+			c := *m
+			clones[idx] = &c
+		}
+	}
+
+	return clones
+}
+
+func (ws *HttpWebsocket) compile() error {
+	var assign []func() // data of messages and pushes, set when all compile
+	for idx, m := range ws.OnConnect {
+		if m == nil {
+			return fmt.Errorf("websocket onConnect message %d is empty", idx)
+		}
+		if err := m.compile(&assign); err != nil {
+			return fmt.Errorf("websocket onConnect message %d: %v", idx, err)
+		}
+	}
+	for idx, p := range ws.Replies {
+		if err := p.compile(&assign); err != nil {
+			return fmt.Errorf("websocket reply %d: %v", idx, err)
+		}
+	}
+	for idx, p := range ws.Pushes {
+		if p == nil || p.Interval <= 0 {
+			return fmt.Errorf("websocket push %d: interval is not set", idx)
+		}
+		data, err := newDataTemplate(p.Data)
+		if err != nil {
+			return fmt.Errorf("websocket push %d: %v", idx, err)
+		}
+		p := p
+		assign = append(assign, func() { p.data = data })
+	}
+	if err := ws.Close.compile(); err != nil {
+		return err
+	}
+	for _, set := range assign {
+		set()
+	}
+
+	return nil
+}
+
+func (p *WsReply) compile(assign *[]func()) error {
+	if p == nil {
+		return errors.New("reply is empty")
+	}
+	if p.Match != nil {
+		if err := p.Match.compile("message", assign); err != nil {
+			return err
+		}
+	}
+	for path, m := range p.Json {
+		if err := m.compile(path, assign); err != nil {
+			return err
+		}
+	}
+	for idx, m := range p.Send {
+		if m == nil {
+			return fmt.Errorf("message %d is empty", idx)
+		}
+		if err := m.compile(assign); err != nil {
+			return fmt.Errorf("message %d: %v", idx, err)
+		}
+	}
+
+	return p.Close.compile()
+}
+
+// compile parses data of message, and adds setting it to assign
+func (m *WsMessage) compile(assign *[]func()) error {
+	data, err := newDataTemplate(m.Data)
+	if err != nil {
+		return err
+	}
+	*assign = append(*assign, func() { m.data = data })
+
+	return nil
+}
+
+func (c *WsClose) compile() error {
+	switch {
+	case c == nil, c.Code == 0:
+	case c.Code < websocket.CloseNormalClosure || c.Code > 4999,
+		c.Code == websocket.CloseNoStatusReceived, c.Code == websocket.CloseAbnormalClosure,
+		c.Code == websocket.CloseTLSHandshake:
+		return fmt.Errorf("invalid close code %d", c.Code)
+	}
+
+	return nil
+}
+
+// match reports whether message matches reply, captured values are added to
+// params. body is the decoded JSON message, nil if not JSON.
+func (p *WsReply) match(message string, body interface{}, params map[string]interface{}) bool {
+	if p.Match != nil && !p.Match.match(message, true) {
+		return false
+	}
+	if len(p.Json) > 0 && body == nil {
+		return false
+	}
+	for path, m := range p.Json {
+		v, exists := jsonPath(body, path)
+		if !m.match(jsonString(v), exists) {
+			return false
+		}
+	}
+
+	if p.Match != nil {
+		p.Match.capture(message, params)
+	}
+	for path, m := range p.Json {
+		v, _ := jsonPath(body, path)
+		m.capture(jsonString(v), params)
+	}
+
+	return true
+}
+
+// serve upgrades request and runs script until connection closed by either
+// side, or server shuts down
+func (ws *HttpWebsocket) serve(w http.ResponseWriter, r *http.Request, params map[string]interface{}) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Errorf("upgrade websocket error: %v", err)
+		return
+	}
+	c := &wsConn{conn: conn, e: journalEntryFromContext(r.Context())}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer func() {
+		c.finish()
+		cancel()
+	}()
+
+	// close on server shutdown, no-op if already finished
+	go func() {
+		<-ctx.Done()
+		if r.Context().Err() != nil {
+			c.close(&WsClose{Code: websocket.CloseGoingAway, Reason: "server shutdown"})
+		}
+	}()
+
+	go func() {
+		if c.sendAll(ctx, ws.OnConnect, params) && ws.Close != nil && sleep(ctx, ws.Close.After) {
+			c.close(ws.Close)
+		}
+	}()
+	for _, p := range ws.Pushes {
+		go c.push(ctx, p, params)
+	}
+
+	for {
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				c.received(websocket.CloseMessage, closeData(ce.Code, ce.Text))
+			}
+			return
+		}
+		c.received(typ, string(data))
+		// replies are sent in order of incoming messages
+		if p, msgParams := ws.reply(string(data), params); p != nil {
+			if c.sendAll(ctx, p.Send, msgParams) && p.Close != nil && sleep(ctx, p.Close.After) {
+				c.close(p.Close)
+			}
+		}
+	}
+}
+
+// reply returns the first reply matching message, and params of message
+func (ws *HttpWebsocket) reply(message string, params map[string]interface{}) (*WsReply, map[string]interface{}) {
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(message)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		body = nil
+	}
+	for _, p := range ws.Replies {
+		msgParams := map[string]interface{}{"message": message}
+		for k, v := range params {
+			msgParams[k] = v
+		}
+		if fields, ok := body.(map[string]interface{}); ok {
+			for k, v := range fields {
+				msgParams[k] = v
+			}
+		}
+		if p.match(message, body, msgParams) {
+			return p, msgParams
+		}
+	}
+
+	return nil, nil
+}
+
+// wsConn serializes writes of connection, and records messages into journal
+type wsConn struct {
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	e      *JournalEntry
+	closed bool // close sent, or connection finished
+}
+
+func (c *wsConn) received(typ int, data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.record("client", typ, data)
+}
+
+// record adds message into journal entry, mu must be held
+func (c *wsConn) record(from string, typ int, data string) {
+	if c.e == nil {
+		return
+	}
+	kind := "text"
+	switch typ {
+	case websocket.BinaryMessage:
+		kind = "binary"
+	case websocket.CloseMessage:
+		kind = "close"
+	}
+	m := &JournalMessage{Time: time.Now(), From: from, Type: kind}
+	m.Data, m.Encoding = encodeText([]byte(data))
+	c.e.Messages = append(c.e.Messages, m)
+}
+
+func (c *wsConn) sendAll(ctx context.Context, messages []*WsMessage, params map[string]interface{}) bool {
+	for _, m := range messages {
+		if !sleep(ctx, m.Delay) || !c.send(m.data, m.Binary, params) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// send renders and writes message, and reports whether connection is still open
+func (c *wsConn) send(data *dataTemplate, binary bool, params map[string]interface{}) bool {
+	rendered, err := data.render(params)
+	if err != nil {
+		slog.Errorf("render websocket message error: %v", err)
+	}
+	typ := websocket.TextMessage
+	if binary {
+		typ = websocket.BinaryMessage
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	c.record("server", typ, rendered)
+	if err := c.conn.WriteMessage(typ, []byte(rendered)); err != nil {
+		slog.Errorf("write websocket message error: %v", err)
+		return false
+	}
+
+	return true
+}
+
+func (c *wsConn) push(ctx context.Context, p *WsPush, params map[string]interface{}) {
+	t := time.NewTicker(time.Duration(p.Interval) * time.Millisecond)
+	defer t.Stop()
+	for i := 0; p.Count == 0 || i < p.Count; i++ {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+		if !c.send(p.data, p.Binary, params) {
+			return
+		}
+	}
+}
+
+// close sends close message, connection is finished on close reply of client
+// or timeout
+func (c *wsConn) close(cl *WsClose) {
+	code := cl.Code
+	if code == 0 {
+		code = websocket.CloseNormalClosure
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.record("server", websocket.CloseMessage, closeData(code, cl.Reason))
+	deadline := time.Now().Add(wsCloseTimeout)
+	if err := c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, cl.Reason), deadline); err != nil {
+		slog.Errorf("write websocket close error: %v", err)
+	}
+	_ = c.conn.SetReadDeadline(deadline)
+}
+
+func (c *wsConn) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	c.conn.Close()
+}
+
+// closeData returns journal data of close message, "code reason"
+func closeData(code int, reason string) string {
+	if reason == "" {
+		return strconv.Itoa(code)
+	}
+
+	return fmt.Sprintf("%d %s", code, reason)
+}
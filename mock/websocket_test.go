@@ -0,0 +1,146 @@
+package mock
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebsocket(t *testing.T) {
+	s := NewHttpServer()
+	err := s.Load([]byte(`
+routes:
+  - uri: /ws/:room
+    websocket:
+      onConnect:
+        - data: welcome to ${room}
+      replies:
+        - match: ping
+          send:
+            - data: pong
+        - match: {regex: "^join (?P<user>\\w+)$"}
+          send:
+            - data: hello ${user} in ${room}
+        - json:
+            $.type: subscribe
+          send:
+            - data: {type: subscribed, channel: "${channel}", rate: 1.50}
+        - match: bye
+          close: {code: 4000, reason: bye}
+  - uri: /ticks
+    websocket:
+      push:
+        - interval: 20
+          count: 2
+          data: {z: tick, a: 1.0}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := s.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "ws://" + addr.String()
+	dial := func(path string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		return conn
+	}
+	read := func(conn *websocket.Conn) string {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err.Error()
+		}
+		return string(data)
+	}
+
+	Convey("reply messages by content", t, func() {
+		conn := dial("/ws/lobby")
+		defer conn.Close()
+		So(read(conn), ShouldEqual, "welcome to lobby")
+		conn.WriteMessage(websocket.TextMessage, []byte("unknown"))
+		conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+		So(read(conn), ShouldEqual, "pong")
+		conn.WriteMessage(websocket.TextMessage, []byte("join alice"))
+		So(read(conn), ShouldEqual, "hello alice in lobby")
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "subscribe", "channel": "news"}`))
+		So(read(conn), ShouldEqual, `{"type":"subscribed","channel":"news","rate":1.50}`)
+	})
+
+	Convey("close with code", t, func() {
+		RequestJournal.Clear()
+		conn := dial("/ws/hall")
+		defer conn.Close()
+		read(conn)
+		conn.WriteMessage(websocket.BinaryMessage, []byte{0xff, 0x00})
+		conn.WriteMessage(websocket.TextMessage, []byte("bye"))
+		_, _, err := conn.ReadMessage()
+		var ce *websocket.CloseError
+		So(errors.As(err, &ce), ShouldBeTrue)
+		So(ce.Code, ShouldEqual, 4000)
+		So(ce.Text, ShouldEqual, "bye")
+
+		Convey("record messages into journal", func() {
+			var entries []*JournalEntry
+			for i := 0; i < 100 && len(entries) == 0; i++ {
+				time.Sleep(10 * time.Millisecond)
+				entries = RequestJournal.Find(&JournalFilter{Path: "/ws/hall"})
+			}
+			So(entries, ShouldHaveLength, 1)
+			So(entries[0].Route, ShouldEqual, "GET /ws/:room")
+			So(entries[0].Response.Code, ShouldEqual, 101)
+			messages := []string{}
+			for _, m := range entries[0].Messages {
+				messages = append(messages, strings.TrimSpace(m.From+" "+m.Type+" "+m.Data+" "+m.Encoding))
+			}
+			So(messages, ShouldResemble, []string{
+				"server text welcome to hall",
+				"client binary /wA= base64",
+				"client text bye",
+				"server close 4000 bye",
+				"client close 4000",
+			})
+		})
+	})
+
+	Convey("push messages periodically", t, func() {
+		conn := dial("/ticks")
+		defer conn.Close()
+		So(read(conn), ShouldEqual, `{"z":"tick","a":1.0}`)
+		So(read(conn), ShouldEqual, `{"z":"tick","a":1.0}`)
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _, err := conn.ReadMessage()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("close on shutdown", t, func() {
+		conn := dial("/ws/lobby")
+		defer conn.Close()
+		read(conn)
+		go s.Shutdown()
+		_, _, err := conn.ReadMessage()
+		So(websocket.IsCloseError(err, websocket.CloseGoingAway), ShouldBeTrue)
+	})
+
+	Convey("check websocket route", t, func() {
+		for _, cfg := range []string{
+			"routes:\n  - uri: /ws\n    websocket: {}\n    response: {code: 200}\n",
+			"routes:\n  - uri: /ws\n    method: POST\n    websocket: {}\n",
+			"routes:\n  - uri: /ws\n    websocket: {close: {code: 1006}}\n",
+			"routes:\n  - uri: /ws\n    websocket: {push: [{data: tick}]}\n",
+			"routes:\n  - uri: /ws\n    websocket: {replies: [{match: {regex: '('}}]}\n",
+		} {
+			s := NewHttpServer()
+			So(s.Load([]byte(cfg)), ShouldBeNil)
+			So(s.initRoutes(), ShouldNotBeNil)
+		}
+	})
+}